@@ -1,5 +1,7 @@
 package imgproxy
 
+import "time"
+
 // Config holds the parameters for constructing an imgproxy URL builder.
 type Config struct {
 	BaseURL       string
@@ -7,4 +9,42 @@ type Config struct {
 	Key           string
 	Salt          string
 	EncodePath    bool
+
+	// AllowRelativeBase allows a BaseURL without scheme and host, to generate path-only URLs.
+	AllowRelativeBase bool
+
+	// MaxOptionValueLen limits the length of a single option value, 0 means no limit.
+	MaxOptionValueLen int
+
+	// OmitResizeDefaults leaves out false enlarge and extend arguments of the resize option.
+	// Enabling it changes the signature of existing URLs.
+	OmitResizeDefaults bool
+
+	// LongKeyOptions holds the long names of the options to emit with their long name instead of the short one.
+	LongKeyOptions map[string]bool
+
+	// SignTrailingPath includes the path set by TrailingPath in the signature.
+	SignTrailingPath bool
+
+	// SortByLongName orders the options by their long name, whether they are emitted with their long or short name.
+	SortByLongName bool
+
+	// TargetVersion is the major version of the imgproxy server, used by Validate to reject options known to require a newer one.
+	// Only a subset of the options is checked, so passing Validate doesn't guarantee the server supports them all.
+	TargetVersion int
+
+	// UnsignedOptions holds the long names of the options to pass in the query string instead of the signed path.
+	// The imgproxy server doesn't read processing options from the query string and ignores them:
+	// they only vary the cache key of a CDN in front of it. Only use it for options that are safe to drop,
+	// like cachebuster. It can't be combined with QueryCacheBust for cachebuster, both use the cb parameter.
+	UnsignedOptions map[string]bool
+
+	// Clock returns the current time for the time dependent options, like ExpiresIn. Defaults to time.Now.
+	Clock func() time.Time
+
+	// WarnDeprecated is called by Generate with the name of every deprecated option set, e.g. to log it.
+	WarnDeprecated func(option string)
+
+	// StrictOptions makes Generate return an error when an option unknown to imgproxy is set, e.g. a typo.
+	StrictOptions bool
 }
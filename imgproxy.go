@@ -3,27 +3,51 @@ package imgproxy
 import (
 	"encoding/hex"
 	stdErrs "errors"
+	"net/url"
+	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
 // Imgproxy is a URL builder helper for imgproxy.
 type Imgproxy struct {
-	cfg  Config
-	key  []byte
-	salt []byte
+	cfg    Config
+	signer Signer
 }
 
 // ErrInvalidSignature error.
 var ErrInvalidSignature = stdErrs.New("invalid signature size")
 
+// ErrInvalidBaseURL error.
+var ErrInvalidBaseURL = stdErrs.New("base url must be absolute")
+
+// ErrMissingEnv error.
+var ErrMissingEnv = stdErrs.New("missing environment variable")
+
 // NewImgproxy returns a new *Imgproxy.
 func NewImgproxy(cfg Config) (*Imgproxy, error) {
 	if !strings.HasSuffix(cfg.BaseURL, "/") {
 		cfg.BaseURL = cfg.BaseURL + "/"
 	}
 
+	if !cfg.AllowRelativeBase {
+		base, err := url.Parse(cfg.BaseURL)
+		if err != nil {
+			return nil, errors.Wrap(ErrInvalidBaseURL, err.Error())
+		}
+
+		if base.Scheme == "" || base.Host == "" {
+			return nil, errors.Wrapf(ErrInvalidBaseURL, "%q", cfg.BaseURL)
+		}
+	}
+
+	if cfg.Clock == nil {
+		cfg.Clock = time.Now
+	}
+
 	if cfg.SignatureSize < 1 || cfg.SignatureSize > 32 {
 		return nil, errors.WithStack(ErrInvalidSignature)
 	}
@@ -38,13 +62,72 @@ func NewImgproxy(cfg Config) (*Imgproxy, error) {
 		return nil, errors.WithStack(err)
 	}
 
+	var signer Signer
+	if len(key) != 0 || len(salt) != 0 {
+		signer = newHMACSigner(key, salt, cfg.SignatureSize)
+	}
+
 	return &Imgproxy{
-		cfg:  cfg,
-		salt: salt,
-		key:  key,
+		cfg:    cfg,
+		signer: signer,
 	}, nil
 }
 
+// NewFromEnv returns a new *Imgproxy configured from the environment.
+// IMGPROXY_URL holds the address of the imgproxy server and the optional IMGPROXY_ENCODE_PATH enables path encoding.
+// IMGPROXY_KEY, IMGPROXY_SALT and the optional IMGPROXY_SIGNATURE_SIZE (defaults to 32) are the same variables
+// as the imgproxy server's. IMGPROXY_BASE_URL is not read: on the server it's the prefix of the source URLs.
+func NewFromEnv() (*Imgproxy, error) {
+	cfg := Config{
+		BaseURL:       os.Getenv("IMGPROXY_URL"),
+		SignatureSize: 32,
+		Key:           os.Getenv("IMGPROXY_KEY"),
+		Salt:          os.Getenv("IMGPROXY_SALT"),
+	}
+
+	if cfg.BaseURL == "" {
+		return nil, errors.Wrap(ErrMissingEnv, "IMGPROXY_URL")
+	}
+
+	if cfg.Key != "" && cfg.Salt == "" {
+		return nil, errors.Wrap(ErrMissingEnv, "IMGPROXY_SALT")
+	}
+
+	if cfg.Salt != "" && cfg.Key == "" {
+		return nil, errors.Wrap(ErrMissingEnv, "IMGPROXY_KEY")
+	}
+
+	if size, ok := os.LookupEnv("IMGPROXY_SIGNATURE_SIZE"); ok {
+		var err error
+		if cfg.SignatureSize, err = strconv.Atoi(size); err != nil {
+			return nil, errors.Wrap(err, "IMGPROXY_SIGNATURE_SIZE")
+		}
+	}
+
+	if encode, ok := os.LookupEnv("IMGPROXY_ENCODE_PATH"); ok {
+		var err error
+		if cfg.EncodePath, err = strconv.ParseBool(encode); err != nil {
+			return nil, errors.Wrap(err, "IMGPROXY_ENCODE_PATH")
+		}
+	}
+
+	return NewImgproxy(cfg)
+}
+
+// WithSigner returns a copy of the *Imgproxy that signs URLs with the given Signer,
+// e.g. one backed by a KMS so the key never leaves it.
+func (i *Imgproxy) WithSigner(signer Signer) *Imgproxy {
+	clone := *i
+	clone.signer = signer
+
+	return &clone
+}
+
+// WillSignInsecurely reports whether generated URLs use the "insecure" signature because no key is configured.
+func (i *Imgproxy) WillSignInsecurely() bool {
+	return i.signer == nil
+}
+
 // Builder returns a *ImgproxyURLData that can be used to construct an imgproxy URL.
 func (i *Imgproxy) Builder() *ImgproxyURLData {
 	return &ImgproxyURLData{
@@ -52,3 +135,14 @@ func (i *Imgproxy) Builder() *ImgproxyURLData {
 		Options:  make(map[string]string, 0),
 	}
 }
+
+// GenerateFromExported generates the imgproxy URL for options exported by ImgproxyURLData.ExportOptions,
+// e.g. when the options are built by a service that doesn't hold the key.
+func (i *Imgproxy) GenerateFromExported(opts map[string]string, uri string) (string, error) {
+	builder := i.Builder()
+	for key, value := range opts {
+		builder.SetOption(key, value)
+	}
+
+	return builder.Generate(uri)
+}
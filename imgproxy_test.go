@@ -1,8 +1,12 @@
 package imgproxy
 
 import (
+	"encoding/base64"
 	"encoding/hex"
+	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
@@ -20,6 +24,196 @@ func Test_NewImgproxy(t *testing.T) {
 			})
 			So(errors.Cause(err), ShouldResemble, ErrInvalidSignature)
 		})
+
+		Convey("Accepts an absolute base URL", func() {
+			_, err := NewImgproxy(Config{
+				BaseURL:       "https://imgproxy.example.com/prefix",
+				SignatureSize: 15,
+			})
+			So(err, ShouldBeNil)
+		})
+
+		Convey("Returns error if the base URL is relative", func() {
+			_, err := NewImgproxy(Config{
+				BaseURL:       "/imgproxy",
+				SignatureSize: 15,
+			})
+			So(errors.Cause(err), ShouldResemble, ErrInvalidBaseURL)
+		})
+
+		Convey("Accepts a relative base URL with AllowRelativeBase", func() {
+			ip, err := NewImgproxy(Config{
+				BaseURL:           "/imgproxy",
+				SignatureSize:     15,
+				AllowRelativeBase: true,
+			})
+			So(err, ShouldBeNil)
+
+			url, err := ip.Builder().Generate("my/image.jpg")
+			So(err, ShouldBeNil)
+			So(url, ShouldEqual, "/imgproxy/insecure/plain/my/image.jpg")
+		})
+	})
+}
+
+func Test_NewFromEnv(t *testing.T) {
+	Convey("NewFromEnv()", t, func() {
+		Convey("Returns an *Imgproxy configured from the environment", func() {
+			t.Setenv("IMGPROXY_URL", "http://localhost")
+			t.Setenv("IMGPROXY_KEY", hex.EncodeToString([]byte("key")))
+			t.Setenv("IMGPROXY_SALT", hex.EncodeToString([]byte("salt")))
+			t.Setenv("IMGPROXY_SIGNATURE_SIZE", "15")
+
+			ip, err := NewFromEnv()
+			So(err, ShouldBeNil)
+
+			url, err := ip.Builder().Generate("my/image.jpg")
+			So(err, ShouldBeNil)
+			So(url, ShouldEqual, "http://localhost/s-cFqOcqN4HMtEZQwoyp/plain/my/image.jpg")
+		})
+
+		Convey("Returns error if the base URL is missing", func() {
+			t.Setenv("IMGPROXY_URL", "")
+
+			_, err := NewFromEnv()
+			So(errors.Cause(err), ShouldResemble, ErrMissingEnv)
+		})
+
+		Convey("Doesn't use the server's IMGPROXY_BASE_URL as the base URL", func() {
+			t.Setenv("IMGPROXY_URL", "")
+			t.Setenv("IMGPROXY_BASE_URL", "http://source-bucket.example.com/")
+
+			_, err := NewFromEnv()
+			So(errors.Cause(err), ShouldResemble, ErrMissingEnv)
+		})
+
+		Convey("Returns error if the salt is missing", func() {
+			t.Setenv("IMGPROXY_URL", "http://localhost")
+			t.Setenv("IMGPROXY_KEY", hex.EncodeToString([]byte("key")))
+			t.Setenv("IMGPROXY_SALT", "")
+
+			_, err := NewFromEnv()
+			So(errors.Cause(err), ShouldResemble, ErrMissingEnv)
+		})
+
+		Convey("Returns error if the key is not hex encoded", func() {
+			t.Setenv("IMGPROXY_URL", "http://localhost")
+			t.Setenv("IMGPROXY_KEY", "not hex")
+			t.Setenv("IMGPROXY_SALT", hex.EncodeToString([]byte("salt")))
+
+			_, err := NewFromEnv()
+			So(err, ShouldNotBeNil)
+		})
+
+		Convey("Returns error if the signature size is invalid", func() {
+			t.Setenv("IMGPROXY_URL", "http://localhost")
+			t.Setenv("IMGPROXY_KEY", "")
+			t.Setenv("IMGPROXY_SALT", "")
+			t.Setenv("IMGPROXY_SIGNATURE_SIZE", "64")
+
+			_, err := NewFromEnv()
+			So(errors.Cause(err), ShouldResemble, ErrInvalidSignature)
+		})
+	})
+}
+
+func Test_WillSignInsecurely(t *testing.T) {
+	Convey("Imgproxy.WillSignInsecurely()", t, func() {
+		Convey("Returns false when a key is configured", func() {
+			ip, err := NewImgproxy(Config{
+				BaseURL:       "http://localhost",
+				SignatureSize: 15,
+				Key:           hex.EncodeToString([]byte("key")),
+				Salt:          hex.EncodeToString([]byte("salt")),
+			})
+			So(err, ShouldBeNil)
+			So(ip.WillSignInsecurely(), ShouldBeFalse)
+		})
+
+		Convey("Returns true when no key is configured", func() {
+			ip, err := NewImgproxy(Config{
+				BaseURL:       "http://localhost",
+				SignatureSize: 15,
+			})
+			So(err, ShouldBeNil)
+			So(ip.WillSignInsecurely(), ShouldBeTrue)
+		})
+	})
+}
+
+func Test_RedactSignature(t *testing.T) {
+	Convey("Imgproxy.RedactSignature()", t, func() {
+		ip, err := NewImgproxy(Config{
+			BaseURL:       "http://localhost",
+			SignatureSize: 15,
+		})
+		So(err, ShouldBeNil)
+
+		Convey("Masks the signature of an absolute URL", func() {
+			So(
+				ip.RedactSignature("http://localhost/T0ConuLHyLnlO4IUVQqd/rs:fit:123:456:1:0/plain/my/image.jpg"),
+				ShouldEqual,
+				"http://localhost/***/rs:fit:123:456:1:0/plain/my/image.jpg",
+			)
+		})
+
+		Convey("Masks the signature after a base URL with a path prefix", func() {
+			prefixed, err := NewImgproxy(Config{
+				BaseURL:       "https://cdn.example.com/img",
+				SignatureSize: 15,
+			})
+			So(err, ShouldBeNil)
+
+			So(
+				prefixed.RedactSignature("https://cdn.example.com/img/AuXl-8YYOfCtdHJrDsTJ/w:300/plain/my/image.jpg"),
+				ShouldEqual,
+				"https://cdn.example.com/img/***/w:300/plain/my/image.jpg",
+			)
+		})
+
+		Convey("Masks the signature of a path-only URL", func() {
+			relative, err := NewImgproxy(Config{
+				BaseURL:           "/",
+				SignatureSize:     15,
+				AllowRelativeBase: true,
+			})
+			So(err, ShouldBeNil)
+
+			So(relative.RedactSignature("/6wIzqvuZtfHT1LL3J_z0/bXkvaW1hZ2UuanBn"), ShouldEqual, "/***/bXkvaW1hZ2UuanBn")
+		})
+
+		Convey("Masks a lone signature", func() {
+			So(ip.RedactSignature("http://localhost/T0ConuLHyLnlO4IUVQqd"), ShouldEqual, "http://localhost/***")
+		})
+
+		Convey("Fully redacts a URL of another base URL", func() {
+			So(ip.RedactSignature("https://cdn.example.com/img/AuXl-8YYOfCtdHJrDsTJ/w:300/plain/my/image.jpg"), ShouldEqual, "***")
+		})
+
+		Convey("Leaves a URL without signature untouched", func() {
+			So(ip.RedactSignature("http://localhost/"), ShouldEqual, "http://localhost/")
+		})
+	})
+}
+
+func Test_SupportedOptions(t *testing.T) {
+	Convey("SupportedOptions()", t, func() {
+		Convey("Lists the long and short option names", func() {
+			options := SupportedOptions()
+
+			So(len(options), ShouldEqual, len(allOptions))
+			So(options[0].Long, ShouldEqual, "resize")
+			So(options[0].Short, ShouldEqual, "rs")
+		})
+
+		Convey("Returns a copy", func() {
+			options := SupportedOptions()
+			options[0].Long = "changed"
+			options[0].Short = "changed"
+
+			So(SupportedOptions()[0].Long, ShouldEqual, "resize")
+			So(allOptions[0].short, ShouldEqual, "rs")
+		})
 	})
 }
 
@@ -84,6 +278,38 @@ func Test_ImgproxyBuilder(t *testing.T) {
 					So(err, ShouldBeNil)
 					So(url, ShouldEqual, "http://localhost/UWRUm-AJnTk16FBM9PL9/rs:fill:123:456:1:0/plain/my/image.jpg")
 				})
+
+				Convey("Fit and FitNoEnlarge differ in the enlarge flag", func() {
+					url, err := ip.Builder().
+						Fit(123, 456).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/T0ConuLHyLnlO4IUVQqd/rs:fit:123:456:1:0/plain/my/image.jpg")
+
+					url, err = ip.Builder().
+						FitNoEnlarge(123, 456).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/zJ7DHlOWLcXfW48-zD35/rs:fit:123:456:0:0/plain/my/image.jpg")
+				})
+
+				Convey("Fill and FillNoEnlarge differ in the enlarge flag", func() {
+					url, err := ip.Builder().
+						Fill(123, 456).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/UWRUm-AJnTk16FBM9PL9/rs:fill:123:456:1:0/plain/my/image.jpg")
+
+					url, err = ip.Builder().
+						FillNoEnlarge(123, 456).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/TH1vghdRUqUlG9Nfeh-d/rs:fill:123:456:0:0/plain/my/image.jpg")
+				})
 			})
 
 			Convey("Size sets size option", func() {
@@ -185,6 +411,18 @@ func Test_ImgproxyBuilder(t *testing.T) {
 					So(err, ShouldBeNil)
 					So(url, ShouldEqual, "http://localhost/tzY1UfBRkno8WSwTFnsN/g:fp:10:20/plain/my/image.jpg")
 				})
+
+				Convey("With FocusPointFraction it sets the option", func() {
+					url, err := ip.Builder().
+						Gravity(FocusPointFraction{
+							X: 0.25,
+							Y: 0.75,
+						}).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/LcgamnTMRlDq62QGN9oT/g:fp:0.25:0.75/plain/my/image.jpg")
+				})
 			})
 
 			Convey("Quality sets the quality option", func() {
@@ -269,6 +507,45 @@ func Test_ImgproxyBuilder(t *testing.T) {
 					So(err, ShouldBeNil)
 					So(url, ShouldEqual, "http://localhost/Kj5PQr1LcllLJp39EZhf/wm:1:we:3/plain/my/image.jpg")
 				})
+
+				Convey("With a fractional scale sets the option", func() {
+					url, err := ip.Builder().
+						Watermark(1, WatermarkPositionWest, &WatermarkOffset{X: 1, Y: 2}, 0.25).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/GcVey3xGxKkALv3geCRP/wm:1:we:1:2:0.25/plain/my/image.jpg")
+				})
+
+				Convey("WatermarkScaleFraction updates the scale of the watermark", func() {
+					url, err := ip.Builder().
+						Watermark(1, WatermarkPositionWest, &WatermarkOffset{X: 1, Y: 2}, 3).
+						WatermarkScaleFraction(0.25).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/GcVey3xGxKkALv3geCRP/wm:1:we:1:2:0.25/plain/my/image.jpg")
+				})
+
+				Convey("WatermarkScaleFraction places a centered watermark when none is set", func() {
+					url, err := ip.Builder().
+						WatermarkScaleFraction(0.25).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/zcXE9mXju8Y_AXuE0YXO/wm:1:ce:0:0:0.25/plain/my/image.jpg")
+				})
+
+				Convey("WatermarkScaleFraction keeps the arguments of a partial watermark", func() {
+					So(ip.Builder().SetOption("wm", "0.5").WatermarkScaleFraction(0.25).Options["wm"], ShouldEqual, "0.5:ce:0:0:0.25")
+					So(ip.Builder().SetOption("wm", "0.5:no").WatermarkScaleFraction(0.25).Options["wm"], ShouldEqual, "0.5:no:0:0:0.25")
+					So(ip.Builder().Watermark(1, WatermarkPositionWest, nil, 3).WatermarkScaleFraction(0.25).Options["wm"], ShouldEqual, "1:we:0:0:0.25")
+				})
+
+				Convey("WatermarkScaleFraction clamps the fraction", func() {
+					So(ip.Builder().WatermarkScaleFraction(1.5).Options["wm"], ShouldEqual, "1:ce:0:0:1")
+					So(ip.Builder().WatermarkScaleFraction(-1).Options["wm"], ShouldEqual, "1:ce:0:0:0")
+				})
 			})
 
 			Convey("Preset sets the preset option", func() {
@@ -306,6 +583,2114 @@ func Test_ImgproxyBuilder(t *testing.T) {
 				So(err, ShouldBeNil)
 				So(url, ShouldEqual, "http://localhost/00J_9T9UyVpOBQkQbodf/c:1:2:ce/plain/my/image.jpg")
 			})
-		})
-	})
+
+			Convey("Crop with a focus point sets the crop option", func() {
+				url, err := ip.Builder().
+					Crop(300, 200, FocusPointFraction{0.5, 0.5}).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/Zle7Uyo-r3KkRTdA48jJ/c:300:200:fp:0.5:0.5/plain/my/image.jpg")
+			})
+
+			Convey("DiffOptions returns the options that differ", func() {
+				a := ip.Builder().Width(100).Quality(80)
+				b := ip.Builder().Width(100).Quality(60)
+
+				So(DiffOptions(a, b), ShouldResemble, map[string][2]string{
+					"q": {"80", "60"},
+				})
+			})
+
+			Convey("FilenameFromSource", func() {
+				Convey("Sets the filename with the format extension", func() {
+					url, err := ip.Builder().
+						FilenameFromSource("http://example.com/images/photo.heic", ImageFormatJPEG).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/RvsGqhwiRuaVbVCQqIa_/fn:photo.jpg/plain/my/image.jpg")
+				})
+
+				Convey("Encodes a non-ASCII filename", func() {
+					url, err := ip.Builder().
+						FilenameFromSource("images/fotó.png?v=1", ImageFormatJPEG).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/d8VXFpO6scxTe2enJ6y6/fn:Zm90w7MuanBn:1/plain/my/image.jpg")
+				})
+
+				Convey("Leaves the filename unset without a basename", func() {
+					for _, uri := range []string{"http://cdn.example.com", "http://x/", ""} {
+						builder := ip.Builder().FilenameFromSource(uri, ImageFormatJPEG)
+
+						So(builder.Options, ShouldBeEmpty)
+					}
+				})
+			})
+
+			Convey("Generate returns error if the source is empty", func() {
+				_, err := ip.Builder().
+					Width(100).
+					Generate("")
+
+				So(errors.Cause(err), ShouldResemble, ErrEmptySource)
+			})
+
+			Convey("Target sets width, height and dpr options", func() {
+				url, err := ip.Builder().
+					Target(300, 200, 1.5).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/585brEt7YOViUkaCjmwd/dpr:1.5/h:200/w:300/plain/my/image.jpg")
+			})
+
+			Convey("GenerateBatch", func() {
+				Convey("Generates a URL for each item", func() {
+					urls, err := ip.GenerateBatch([]BatchItem{
+						{URI: "a.jpg", Spec: TransformSpec{ResizingType: ResizingTypeFill, Width: 100}},
+						{URI: "b.jpg", Spec: TransformSpec{Quality: 80, Format: ImageFormatWebP}},
+					})
+
+					So(err, ShouldBeNil)
+					So(urls, ShouldResemble, []string{
+						"http://localhost/frh0NHr82iQNGorqqAt5/rs:fill/w:100/plain/a.jpg",
+						"http://localhost/MQIccICNLCSNAfjREF0H/f:webp/q:80/plain/b.jpg",
+					})
+				})
+
+				Convey("Returns error for an invalid spec", func() {
+					urls, err := ip.GenerateBatch([]BatchItem{
+						{URI: "a.jpg", Spec: TransformSpec{Width: 100}},
+						{URI: "b.jpg", Spec: TransformSpec{Quality: 101}},
+					})
+
+					So(urls, ShouldBeNil)
+					So(errors.Cause(err), ShouldResemble, ErrInvalidTransformSpec)
+					So(err.Error(), ShouldContainSubstring, "batch item 1 (b.jpg)")
+				})
+			})
+
+			Convey("VerifyEncoding", func() {
+				Convey("Passes for correctly encoded options", func() {
+					err := ip.Builder().
+						FilenameFromSource("images/fotó.png", ImageFormatJPEG).
+						SetOption("st", "Ym9keSB7IGNvbG9yOiByZWQgfQ").
+						VerifyEncoding()
+
+					So(err, ShouldBeNil)
+				})
+
+				Convey("Fails for a corrupted option", func() {
+					err := ip.Builder().
+						SetOption("st", "body { color: red }").
+						VerifyEncoding()
+
+					So(errors.Cause(err), ShouldResemble, ErrInvalidEncoding)
+				})
+			})
+
+			Convey("SetOptionArgs escapes arguments containing the separator", func() {
+				url, err := ip.Builder().
+					SetOptionArgs("fn", "report-12:30.pdf", "0").
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/00UfSZPQT5Gk-HixzFhT/fn:report-12%3A30.pdf:0/plain/my/image.jpg")
+			})
+
+			Convey("Retina generates a 1x and a 2x URL", func() {
+				builder := ip.Builder().Quality(80)
+				normal, retina, err := builder.Retina("my/image.jpg", 300)
+
+				So(err, ShouldBeNil)
+				So(normal, ShouldEqual, "http://localhost/BJ2szP02ARh_L7lJhju3/q:80/w:300/plain/my/image.jpg")
+				So(retina, ShouldEqual, "http://localhost/GJNNENnK-nEqJ1kJ2meW/dpr:2/q:80/w:300/plain/my/image.jpg")
+				So(builder.Options, ShouldResemble, map[string]string{"q": "80"})
+			})
+
+			Convey("GenerateFromURL matches Generate with the URL string", func() {
+				src, err := url.Parse("https://example.com/images/my%20image.jpg?v=1")
+				So(err, ShouldBeNil)
+
+				fromURL, err := ip.Builder().Width(100).GenerateFromURL(src)
+				So(err, ShouldBeNil)
+
+				fromString, err := ip.Builder().Width(100).Generate(src.String())
+				So(err, ShouldBeNil)
+
+				So(fromURL, ShouldEqual, fromString)
+			})
+
+			Convey("Canonicalize", func() {
+				Convey("Canonicalizes equivalent URLs to the same output", func() {
+					a, err := ip.Canonicalize("http://localhost/MjA8q72VEd-WB1Caeozf/w:300/q:80/plain/my/image.jpg")
+					So(err, ShouldBeNil)
+
+					b, err := ip.Canonicalize("http://localhost/_Xu4v-ifz3w-ewcZ4WW1/quality:80/width:300/plain/my/image.jpg")
+					So(err, ShouldBeNil)
+
+					So(a, ShouldEqual, "http://localhost/BJ2szP02ARh_L7lJhju3/q:80/w:300/plain/my/image.jpg")
+					So(b, ShouldEqual, a)
+				})
+
+				Convey("Keeps an encoded source encoded", func() {
+					encoded := "http://localhost/00vOqTGktu_ZSJ639fsy/w:5/aHR0cDovL3guY29tL2EuanBnP3NpemU9MSZ2PUAy"
+
+					url, err := ip.Canonicalize(encoded)
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, encoded)
+				})
+
+				Convey("Encodes an escaped plain source", func() {
+					url, err := ip.Canonicalize("http://localhost/opxIC92aIVafMz6_Gv_Z/w:300/plain/my%20image.jpg")
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/yuC0b8X91Zdo8Dl_myz9/w:300/bXkgaW1hZ2UuanBn")
+				})
+
+				Convey("Keeps the query cache bust", func() {
+					generated, err := ip.Builder().Width(300).QueryCacheBust("v1").Generate("my/image.jpg")
+					So(err, ShouldBeNil)
+
+					url, err := ip.Canonicalize(generated)
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, generated)
+				})
+
+				Convey("Keeps an unsigned trailing path", func() {
+					generated, err := ip.Builder().Width(300).Extension("png").TrailingPath("cdn/edge").Generate("my/image.jpg")
+					So(err, ShouldBeNil)
+
+					url, err := ip.Canonicalize(generated)
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, generated)
+				})
+
+				Convey("Returns error for a forged URL", func() {
+					_, err := ip.Canonicalize("http://localhost/forged/w:9999/plain/http://evil/a.jpg")
+					So(errors.Cause(err), ShouldResemble, ErrSignatureMismatch)
+				})
+
+				Convey("Returns error for a URL of another base URL", func() {
+					_, err := ip.Canonicalize("http://example.com/unsigned/w:300/plain/my/image.jpg")
+					So(errors.Cause(err), ShouldResemble, ErrInvalidURL)
+				})
+
+				Convey("Returns error for malformed URLs", func() {
+					for _, malformed := range []string{
+						"http://localhost/",
+						"http://localhost//w:300/plain/my/image.jpg",
+						"http://localhost/F3MbHRIELHa4FLTCgghr/w:300//plain/my/image.jpg",
+						"http://localhost/kjbZANOP-ke1l8BDrbRx/w:300/plain/",
+						"http://localhost/1C5mt4OJ6o2jE8BqEYrN/bXkvaW1hZ2UuanBnX",
+					} {
+						_, err := ip.Canonicalize(malformed)
+						So(errors.Cause(err), ShouldResemble, ErrInvalidURL)
+					}
+				})
+			})
+
+			Convey("Validate", func() {
+				Convey("Flags min-width with force resizing", func() {
+					issues := ip.Builder().
+						Resize(ResizingTypeForce, 300, 200, false, false).
+						SetOption("mw", "100").
+						Validate()
+
+					So(issues, ShouldHaveLength, 1)
+					So(errors.Cause(issues[0]), ShouldResemble, ErrIneffectiveOption)
+				})
+
+				Convey("Passes min-width with fit resizing", func() {
+					issues := ip.Builder().
+						Resize(ResizingTypeFit, 300, 200, false, false).
+						SetOption("mw", "100").
+						Validate()
+
+					So(issues, ShouldBeEmpty)
+				})
+
+				Convey("Flags quality with PNG format", func() {
+					issues := ip.Builder().
+						FormatWithQuality(ImageFormatPNG, 80).
+						Validate()
+
+					So(issues, ShouldHaveLength, 1)
+					So(errors.Cause(issues[0]), ShouldResemble, ErrIneffectiveOption)
+				})
+
+				Convey("Passes quality with JPEG format", func() {
+					builder := ip.Builder().FormatWithQuality(ImageFormatJPEG, 80)
+
+					So(builder.Validate(), ShouldBeEmpty)
+					So(builder.Options["f"], ShouldEqual, "jpg")
+					So(builder.Options["q"], ShouldEqual, "80")
+				})
+			})
+
+			Convey("ProgressiveJPEG sets the format and jpeg options", func() {
+				url, err := ip.Builder().
+					ProgressiveJPEG().
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/g8DS2hD9gBQmxY9VHL79/f:jpg/jpgo:1/plain/my/image.jpg")
+			})
+
+			Convey("Extension", func() {
+				Convey("Appends the extension to the source", func() {
+					url, err := ip.Builder().
+						Width(100).
+						Extension("png").
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/eQARixpvuEiIWV7xhDKr/w:100/plain/my/image.jpg@png")
+				})
+
+				Convey("Returns error when the format option is set too", func() {
+					_, err := ip.Builder().
+						Format("webp").
+						Extension("png").
+						Generate("my/image.jpg")
+
+					So(errors.Cause(err), ShouldResemble, ErrFormatConflict)
+				})
+			})
+
+			Convey("DataURISource encodes a data URI as the source", func() {
+				png, err := hex.DecodeString("89504e470d0a1a0a0000000d4948445200000001000000010806000000")
+				So(err, ShouldBeNil)
+
+				url, err := ip.Builder().
+					Width(100).
+					DataURISource("image/png", png).
+					Generate("")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/vJ78g1GCS3Lgysk7aHpk/w:100/ZGF0YTppbWFnZS9wbmc7YmFzZTY0LGlWQk9SdzBLR2dvQUFBQU5TVWhFVWdBQUFBRUFBQUFCQ0FZQUFBQT0")
+			})
+
+			Convey("Option names are matched case-insensitively", func() {
+				a := ip.Builder().SetOption("Width", "100")
+				b := ip.Builder().SetOption("WIDTH", "100")
+				c := ip.Builder().SetOption("width", "100")
+				d := ip.Builder().SetOption("W", "100")
+
+				So(a.Options, ShouldResemble, map[string]string{"w": "100"})
+				So(b.Options, ShouldResemble, a.Options)
+				So(c.Options, ShouldResemble, a.Options)
+				So(d.Options, ShouldResemble, a.Options)
+
+				So(ip.Builder().Width(100).Height(200).RemoveOption("HEIGHT").Options, ShouldResemble, a.Options)
+				So(ip.Builder().Width(100).Height(200).Only("Width").Options, ShouldResemble, a.Options)
+			})
+
+			Convey("GenerateWithHashsum signs the hashsum option", func() {
+				url, err := ip.Builder().
+					Width(100).
+					GenerateWithHashsum("my/image.jpg", "sha256", "abc123")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/VjXY84teJYMChD--pqhp/hs:sha256:abc123/w:100/plain/my/image.jpg")
+			})
+
+			Convey("DownloadAs sets the return attachment and filename options", func() {
+				url, err := ip.Builder().
+					DownloadAs("invoice.png").
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/FIiMWsKGk8cniSjziAzT/att:1/fn:invoice.png/plain/my/image.jpg")
+			})
+
+			Convey("HighQualityDownscale sets the resizing algorithm option", func() {
+				url, err := ip.Builder().
+					HighQualityDownscale().
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/Gg4Y-5qpoatfrQ20Wbvi/ra:lanczos3/plain/my/image.jpg")
+			})
+
+			Convey("Scheme", func() {
+				Convey("Overrides the scheme of the base URL", func() {
+					url, err := ip.Builder().
+						Scheme("https").
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "https://localhost/s-cFqOcqN4HMtEZQwoyp/plain/my/image.jpg")
+				})
+
+				Convey("Returns error for a scheme other than http or https", func() {
+					_, err := ip.Builder().
+						Scheme("ftp").
+						Generate("my/image.jpg")
+
+					So(errors.Cause(err), ShouldResemble, ErrInvalidScheme)
+				})
+
+				Convey("Returns error for a base URL without host", func() {
+					relative, err := NewImgproxy(Config{
+						BaseURL:           "/imgproxy",
+						SignatureSize:     15,
+						AllowRelativeBase: true,
+					})
+					So(err, ShouldBeNil)
+
+					_, err = relative.Builder().
+						Scheme("https").
+						Generate("my/image.jpg")
+
+					So(errors.Cause(err), ShouldResemble, ErrInvalidBaseURL)
+				})
+
+				Convey("Overrides the scheme of a protocol-relative base URL", func() {
+					relative, err := NewImgproxy(Config{
+						BaseURL:           "//localhost",
+						SignatureSize:     15,
+						AllowRelativeBase: true,
+					})
+					So(err, ShouldBeNil)
+
+					url, err := relative.Builder().
+						Scheme("https").
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "https://localhost/insecure/plain/my/image.jpg")
+				})
+			})
+
+			Convey("QueryCacheBust appends the unsigned query string", func() {
+				url, err := ip.Builder().
+					QueryCacheBust("v 2").
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/s-cFqOcqN4HMtEZQwoyp/plain/my/image.jpg?cb=v+2")
+			})
+
+			Convey("ResultAspectRatio", func() {
+				Convey("Returns the ratio of a fill resize", func() {
+					w, h, ok := ip.Builder().
+						Fill(1600, 900).
+						ResultAspectRatio()
+
+					So(ok, ShouldBeTrue)
+					So(w, ShouldEqual, 16)
+					So(h, ShouldEqual, 9)
+				})
+
+				Convey("Is not determinable for a fit resize", func() {
+					_, _, ok := ip.Builder().
+						Fit(1600, 900).
+						ResultAspectRatio()
+
+					So(ok, ShouldBeFalse)
+				})
+
+				Convey("Uses the resize height over an earlier emitted height", func() {
+					w, h, ok := ip.Builder().
+						Fill(1600, 900).
+						Height(100).
+						ResultAspectRatio()
+
+					So(ok, ShouldBeTrue)
+					So(w, ShouldEqual, 16)
+					So(h, ShouldEqual, 9)
+				})
+
+				Convey("Uses a later emitted width over the resize width", func() {
+					w, h, ok := ip.Builder().
+						Fill(1600, 900).
+						Width(900).
+						ResultAspectRatio()
+
+					So(ok, ShouldBeTrue)
+					So(w, ShouldEqual, 1)
+					So(h, ShouldEqual, 1)
+				})
+			})
+
+			Convey("Generate can be called several times on the same builder", func() {
+				builder := ip.Builder().Width(300).Quality(80)
+
+				a, err := builder.Generate("a.jpg")
+				So(err, ShouldBeNil)
+				So(a, ShouldEqual, "http://localhost/P-Vmpx2zomyDdrx36I0y/q:80/w:300/plain/a.jpg")
+
+				b, err := builder.Generate("b.jpg")
+				So(err, ShouldBeNil)
+				So(b, ShouldEqual, "http://localhost/52LG4bdhJSuAQvEMTrG5/q:80/w:300/plain/b.jpg")
+			})
+
+			Convey("DryRun returns the signed URL without the signature", func() {
+				builder := ip.Builder().Width(300).Quality(80)
+
+				url, err := builder.Generate("my/image.jpg")
+				So(err, ShouldBeNil)
+
+				So(builder.DryRun("my/image.jpg"), ShouldEqual, "/q:80/w:300/plain/my/image.jpg")
+				So(url, ShouldEqual, "http://localhost/BJ2szP02ARh_L7lJhju3"+builder.DryRun("my/image.jpg"))
+			})
+
+			Convey("Resizing algorithm and return attachment are separate options", func() {
+				url, err := ip.Builder().
+					ResizingAlgorithm(ResizingAlgorithmLanczos3).
+					ReturnAttachment(true).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/e2Gd2-uK-uVOGvsA04QH/att:1/ra:lanczos3/plain/my/image.jpg")
+			})
+
+			Convey("ValidateDimensions", func() {
+				Convey("Returns error when the resolution exceeds the limit", func() {
+					err := ip.Builder().
+						Fill(4000, 3000).
+						DPR(2).
+						ValidateDimensions(40)
+
+					So(errors.Cause(err), ShouldResemble, ErrResolutionTooHigh)
+				})
+
+				Convey("Passes when the resolution is within the limit", func() {
+					err := ip.Builder().
+						Fill(4000, 3000).
+						ValidateDimensions(40)
+
+					So(err, ShouldBeNil)
+				})
+
+				Convey("Uses the resize height over an earlier emitted height", func() {
+					err := ip.Builder().
+						Fill(8000, 6000).
+						Height(100).
+						ValidateDimensions(40)
+
+					So(errors.Cause(err), ShouldResemble, ErrResolutionTooHigh)
+				})
+			})
+
+			Convey("Setting gravity twice emits a single gravity option", func() {
+				url, err := ip.Builder().
+					Gravity(GravityEnumCenter).
+					Gravity(OffsetGravity{
+						Type:    GravityEnumNorth,
+						XOffset: 10,
+						YOffset: 20,
+					}).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/Y4L9ShmQTBTGIIINzZ3S/g:no:10:20/plain/my/image.jpg")
+			})
+
+			Convey("Trim", func() {
+				Convey("With all parameters sets the option", func() {
+					url, err := ip.Builder().
+						Trim(10.5, "FF00FF", true, false).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/Z7EtxwgqDzhcuBCXSIt3/t:10.5:FF00FF:1:0/plain/my/image.jpg")
+				})
+
+				Convey("With threshold only sets the option", func() {
+					url, err := ip.Builder().
+						Trim(10, "", false, false).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/Yy1UyzuIz3Mq7cOSto8r/t:10/plain/my/image.jpg")
+				})
+			})
+
+			Convey("TrailingPath appends the unsigned suffix after the source", func() {
+				url, err := ip.Builder().
+					Width(100).
+					TrailingPath("/cdn/edge").
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/DrneV2BWFeLEQo8c7L84/w:100/plain/my/image.jpg/cdn/edge")
+			})
+
+			Convey("Padding", func() {
+				Convey("With different sides sets the option", func() {
+					url, err := ip.Builder().
+						Padding(10, 20, 30, 40).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/Q0U8VxmxeegdUgw1qoMT/pd:10:20:30:40/plain/my/image.jpg")
+				})
+
+				Convey("PaddingAll sets a single value", func() {
+					url, err := ip.Builder().
+						PaddingAll(10).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/KJ1ppXIPY2J0LF8eGwZE/pd:10/plain/my/image.jpg")
+				})
+			})
+
+			Convey("AsCurl returns a curl command for the generated URL", func() {
+				cmd, err := ip.Builder().
+					Width(100).
+					AsCurl("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(cmd, ShouldEqual, "curl -I 'http://localhost/DrneV2BWFeLEQo8c7L84/w:100/plain/my/image.jpg'")
+			})
+
+			Convey("Extend", func() {
+				Convey("With GravityEnum sets the option", func() {
+					url, err := ip.Builder().
+						Extend(true, GravityEnumSouth).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/ImtQS5OZd2SsRIC79IbQ/ex:1:so/plain/my/image.jpg")
+				})
+
+				Convey("With OffsetGravity sets the option", func() {
+					url, err := ip.Builder().
+						Extend(true, OffsetGravity{
+							Type:    GravityEnumSouth,
+							XOffset: 10,
+							YOffset: 5,
+						}).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/U7dG4xFrzQLU8mwmxDaq/ex:1:so:10:5/plain/my/image.jpg")
+				})
+
+				Convey("Without gravity sets only the flag", func() {
+					url, err := ip.Builder().
+						Extend(true, nil).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/u3VvfvRK7TKPKNeeKONU/ex:1/plain/my/image.jpg")
+				})
+			})
+
+			Convey("ExtendAspectRatio sets the option", func() {
+				url, err := ip.Builder().
+					ExtendAspectRatio(true, GravityEnumEast).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/k-FrxSuBgKk4KD2182jq/exar:1:ea/plain/my/image.jpg")
+			})
+
+			Convey("FormatBestWith", func() {
+				Convey("Sets the ordered format list", func() {
+					url, err := ip.Builder().
+						FormatBestWith(ImageFormatAVIF, ImageFormatWebP, ImageFormatJPEG).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/sKWDWOTWli-kOnK_2LEi/f:best:avif:webp:jpg/plain/my/image.jpg")
+				})
+
+				Convey("Returns error for an empty list", func() {
+					_, err := ip.Builder().
+						FormatBestWith().
+						Generate("my/image.jpg")
+
+					So(errors.Cause(err), ShouldResemble, ErrEmptyFormatList)
+				})
+			})
+
+			Convey("Rotate", func() {
+				Convey("With a valid angle sets the option", func() {
+					for angle, expected := range map[int]string{
+						0:   "http://localhost/Iopc50KKQfLuLZ_N6oXf/rot:0/plain/my/image.jpg",
+						90:  "http://localhost/oFV2Nztm37FqZ36L1fLI/rot:90/plain/my/image.jpg",
+						180: "http://localhost/gwVIqc5Y09WG4GTnRUBG/rot:180/plain/my/image.jpg",
+						270: "http://localhost/hLBy124-RJuN9-SMsqTp/rot:270/plain/my/image.jpg",
+					} {
+						url, err := ip.Builder().
+							Rotate(angle).
+							Generate("my/image.jpg")
+
+						So(err, ShouldBeNil)
+						So(url, ShouldEqual, expected)
+					}
+				})
+
+				Convey("With an invalid angle returns error", func() {
+					_, err := ip.Builder().
+						Rotate(45).
+						Generate("my/image.jpg")
+
+					So(errors.Cause(err), ShouldResemble, ErrInvalidRotation)
+				})
+			})
+
+			Convey("ExpectedContentType", func() {
+				Convey("Returns the type of the format option", func() {
+					contentType, ok := ip.Builder().
+						Format("webp").
+						ExpectedContentType()
+
+					So(ok, ShouldBeTrue)
+					So(contentType, ShouldEqual, "image/webp")
+				})
+
+				Convey("Returns the type of the source extension", func() {
+					contentType, ok := ip.Builder().
+						Extension("jpg").
+						ExpectedContentType()
+
+					So(ok, ShouldBeTrue)
+					So(contentType, ShouldEqual, "image/jpeg")
+				})
+
+				Convey("Is undetermined for the best format or no format", func() {
+					_, ok := ip.Builder().
+						FormatBestWith(ImageFormatAVIF, ImageFormatWebP).
+						ExpectedContentType()
+					So(ok, ShouldBeFalse)
+
+					_, ok = ip.Builder().ExpectedContentType()
+					So(ok, ShouldBeFalse)
+				})
+			})
+
+			Convey("AutoRotate sets the auto rotate option", func() {
+				url, err := ip.Builder().
+					AutoRotate(true).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/0yhTxtktAjQAcK0EC45q/ar:1/plain/my/image.jpg")
+
+				url, err = ip.Builder().
+					AutoRotate(false).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/Ir7RBAQPc-freOKeeRJg/ar:0/plain/my/image.jpg")
+			})
+
+			Convey("WithWatermarkApplied returns a clone with the watermark", func() {
+				builder := ip.Builder()
+				clone := builder.WithWatermarkApplied(WatermarkConfig{
+					Opacity:  1,
+					Position: WatermarkPositionWest,
+					Scale:    3,
+				})
+
+				_, ok := builder.Options["wm"]
+				So(ok, ShouldBeFalse)
+
+				url, err := clone.Generate("my/image.jpg")
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/Kj5PQr1LcllLJp39EZhf/wm:1:we:3/plain/my/image.jpg")
+			})
+
+			Convey("Zoom", func() {
+				Convey("With equal factors sets a single value", func() {
+					url, err := ip.Builder().
+						Zoom(2, 2).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/SsNxZFYeu0MZ8cipj_5u/z:2/plain/my/image.jpg")
+				})
+
+				Convey("With different factors sets both", func() {
+					url, err := ip.Builder().
+						Zoom(1.5, 2.25).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/fkjU3dpLEPQIG0NJ6WGK/z:1.5:2.25/plain/my/image.jpg")
+				})
+			})
+
+			Convey("MinWidth and MinHeight set the min width and height options", func() {
+				url, err := ip.Builder().
+					MinWidth(100).
+					MinHeight(200).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/9X-1iASeKjmle9yquqOF/mh:200/mw:100/plain/my/image.jpg")
+				So(ip.Builder().SetOption("min_width", "100").Options, ShouldResemble, map[string]string{"mw": "100"})
+			})
+
+			Convey("Brightness sets the brightness option", func() {
+				url, err := ip.Builder().
+					Brightness(-10).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/zYBbCv2rwJg2PGXMV4x5/br:-10/plain/my/image.jpg")
+			})
+
+			Convey("Contrast sets the contrast option", func() {
+				url, err := ip.Builder().
+					Contrast(1.5).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/lcWVp6gqrkFSmeOh95lN/co:1.5/plain/my/image.jpg")
+			})
+
+			Convey("Saturation sets the saturation option", func() {
+				url, err := ip.Builder().
+					Saturation(0.5).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/HA_HI_Ww8lEy1vQT6SOl/sa:0.5/plain/my/image.jpg")
+			})
+
+			Convey("Adjust sets the adjust option", func() {
+				url, err := ip.Builder().
+					Adjust(-10, 1.5, 0.5).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/VPgaFlwsuCdhGVOuP0wM/a:-10:1.5:0.5/plain/my/image.jpg")
+			})
+
+			Convey("Pixelate", func() {
+				Convey("With a positive size sets the option", func() {
+					url, err := ip.Builder().
+						Pixelate(8).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/5TwYzZT5i1PKncFLgP2w/pix:8/plain/my/image.jpg")
+				})
+
+				Convey("With zero skips option", func() {
+					url, err := ip.Builder().
+						Pixelate(0).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/s-cFqOcqN4HMtEZQwoyp/plain/my/image.jpg")
+				})
+			})
+
+			Convey("LowHigh generates a low and a high width URL", func() {
+				low, high, err := ip.Builder().
+					Quality(80).
+					LowHigh("my/image.jpg", 40, 1200)
+
+				So(err, ShouldBeNil)
+				So(low, ShouldEqual, "http://localhost/_utlhnK3-HupY9AUUn-a/q:80/w:40/plain/my/image.jpg")
+				So(high, ShouldEqual, "http://localhost/ulxLAzQarT-c0gLYol4M/q:80/w:1200/plain/my/image.jpg")
+			})
+
+			Convey("UnsharpMasking", func() {
+				Convey("With mode only sets the option", func() {
+					url, err := ip.Builder().
+						UnsharpMasking(UnsharpMaskingModeAuto, 0, 0).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/KWYTLRqDoUZ7OIKyenlZ/ush:auto/plain/my/image.jpg")
+				})
+
+				Convey("With all parameters sets the option", func() {
+					url, err := ip.Builder().
+						UnsharpMasking(UnsharpMaskingModeAlways, 1.5, 24).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/DAEklUTFbxxb8YoAQ4gC/ush:always:1.5:24/plain/my/image.jpg")
+				})
+			})
+
+			Convey("BlurDetections", func() {
+				Convey("Without classes sets the option", func() {
+					url, err := ip.Builder().
+						BlurDetections(10).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/jKPLgXTMmfjEf7fNH-tT/bd:10/plain/my/image.jpg")
+				})
+
+				Convey("With classes sets the option", func() {
+					url, err := ip.Builder().
+						BlurDetections(10, "face", "license_plate").
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/Qua_h_YPkvWGJSNhYDRO/bd:10:face:license_plate/plain/my/image.jpg")
+				})
+			})
+
+			Convey("DrawDetections", func() {
+				Convey("Without classes sets the option", func() {
+					url, err := ip.Builder().
+						DrawDetections(true).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/hOzYe4QBohWfhSNV_izO/dd:1/plain/my/image.jpg")
+				})
+
+				Convey("With classes sets the option", func() {
+					url, err := ip.Builder().
+						DrawDetections(true, "face", "cat").
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/egnwccdoIszyxlw9CIoA/dd:1:face:cat/plain/my/image.jpg")
+				})
+			})
+
+			Convey("FocusVariants generates a URL for each focus point", func() {
+				urls, err := ip.Builder().
+					Fill(300, 200).
+					FocusVariants("my/image.jpg", []FocusPointFraction{{0.25, 0.5}, {0.75, 0.5}})
+
+				So(err, ShouldBeNil)
+				So(urls, ShouldResemble, []string{
+					"http://localhost/VWumQvUaqNGAGHSQgVCb/g:fp:0.25:0.5/rs:fill:300:200:1:0/plain/my/image.jpg",
+					"http://localhost/iRylAcXy_O6OypmMnJkV/g:fp:0.75:0.5/rs:fill:300:200:1:0/plain/my/image.jpg",
+				})
+			})
+
+			Convey("Gradient", func() {
+				Convey("With opacity only sets the option", func() {
+					url, err := ip.Builder().
+						Gradient(0.5, "", "", 0, 0).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/VWgRvi0eBiIxK-CK2yW5/gr:0.5/plain/my/image.jpg")
+				})
+
+				Convey("With all parameters sets the option", func() {
+					url, err := ip.Builder().
+						Gradient(0.5, "FF0000", GradientUp, 0.2, 0.8).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/a2E8Ih8NlQMT6blMzGYB/gr:0.5:FF0000:up:0.2:0.8/plain/my/image.jpg")
+				})
+
+				Convey("With a typed direction sets the option", func() {
+					url, err := ip.Builder().
+						Gradient(0.5, "FF0000", GradientRight, 0, 0).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/lE20Lg8Duak19kOiXipZ/gr:0.5:FF0000:right/plain/my/image.jpg")
+				})
+
+				Convey("With a custom direction sets the option", func() {
+					url, err := ip.Builder().
+						Gradient(0.5, "FF0000", GradientDirection("45"), 0, 0).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/fMpzXxk1pK83S0fgLuYy/gr:0.5:FF0000:45/plain/my/image.jpg")
+				})
+			})
+
+			Convey("WatermarkURL sets the encoded watermark url option", func() {
+				builder := ip.Builder().WatermarkURL("https://example.com/logo.png")
+
+				So(builder.Options["wmu"], ShouldEqual, "aHR0cHM6Ly9leGFtcGxlLmNvbS9sb2dvLnBuZw")
+				So(builder.VerifyEncoding(), ShouldBeNil)
+			})
+
+			Convey("AspectLock", func() {
+				Convey("Sets the height matching the ratio", func() {
+					url, err := ip.Builder().
+						AspectLock(1600, 16.0/9.0).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/YRhu-hy9FWc_DfInH7no/h:900/rs:fill/w:1600/plain/my/image.jpg")
+				})
+
+				Convey("Returns error for a non-positive ratio", func() {
+					_, err := ip.Builder().
+						AspectLock(1600, 0).
+						Generate("my/image.jpg")
+
+					So(errors.Cause(err), ShouldResemble, ErrInvalidAspectRatio)
+				})
+			})
+
+			Convey("WatermarkText sets the encoded watermark text option", func() {
+				text := `<span foreground="red">© Example Inc.</span>`
+				builder := ip.Builder().WatermarkText(text)
+
+				decoded, err := base64.RawURLEncoding.DecodeString(builder.Options["wmt"])
+				So(err, ShouldBeNil)
+				So(string(decoded), ShouldEqual, text)
+				So(builder.Options["wmt"], ShouldNotContainSubstring, " ")
+			})
+
+			Convey("Watermark size, rotation and shadow", func() {
+				Convey("WatermarkSize preserves the aspect ratio with a zero height", func() {
+					url, err := ip.Builder().
+						WatermarkSize(200, 0).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/dWryy9UyPH1WdvCR4wya/wms:200:0/plain/my/image.jpg")
+				})
+
+				Convey("WatermarkRotate", func() {
+					url, err := ip.Builder().
+						WatermarkRotate(45.5).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/uJbTlbh2ChEVqfSCraod/wmr:45.5/plain/my/image.jpg")
+				})
+
+				Convey("WatermarkShadow", func() {
+					url, err := ip.Builder().
+						WatermarkShadow(2.5).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/Kb7XQFPUzPMO3kTxBHIr/wmsh:2.5/plain/my/image.jpg")
+				})
+			})
+
+			Convey("Then uses the generated URL as source of the next pass", func() {
+				inner, err := ip.Builder().Fill(300, 200).Generate("my/image.jpg")
+				So(err, ShouldBeNil)
+
+				outer, err := ip.Builder().
+					Fill(300, 200).
+					Then().
+					Quality(70).
+					Format("png").
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+
+				parts := strings.Split(outer, "/")
+				source, err := base64.RawURLEncoding.DecodeString(parts[len(parts)-1])
+				So(err, ShouldBeNil)
+				So(string(source), ShouldEqual, inner)
+				So(outer, ShouldContainSubstring, "/f:png/q:70/")
+				So(outer, ShouldNotContainSubstring, "rs:fill")
+			})
+
+			Convey("DryRun after Then returns the path of the last pass", func() {
+				builder := ip.Builder().Fill(300, 200).Then().Quality(70)
+
+				url, err := builder.Generate("my/image.jpg")
+				So(err, ShouldBeNil)
+
+				path := builder.DryRun("my/image.jpg")
+				So(path, ShouldStartWith, "/q:70/")
+				So(url, ShouldEndWith, path)
+
+				signature, err := ip.signer.Sign(path)
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/"+signature+path)
+			})
+
+			Convey("Style sets the encoded CSS option", func() {
+				builder := ip.Builder().Style("path { fill: red; stroke: none; }")
+				url, err := builder.Generate("my/icon.svg")
+
+				So(err, ShouldBeNil)
+				So(builder.Options["st"], ShouldNotContainSubstring, ":")
+				So(builder.Options["st"], ShouldNotContainSubstring, ";")
+				So(builder.VerifyEncoding(), ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/__Ssvn06b-IIiJYEUdAL/st:cGF0aCB7IGZpbGw6IHJlZDsgc3Ryb2tlOiBub25lOyB9/plain/my/icon.svg")
+			})
+
+			Convey("Metadata options", func() {
+				Convey("Sets enabled values", func() {
+					url, err := ip.Builder().
+						StripMetadata(true).
+						KeepCopyright(false).
+						StripColorProfile(true).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/iGlZDrHzoOJ2jDCivrgC/kcr:0/scp:1/sm:1/plain/my/image.jpg")
+				})
+
+				Convey("Sets disabled values", func() {
+					url, err := ip.Builder().
+						StripMetadata(false).
+						KeepCopyright(true).
+						StripColorProfile(false).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/6cmcYCy3YwTNmRt-8rfx/kcr:1/scp:0/sm:0/plain/my/image.jpg")
+				})
+			})
+
+			Convey("DPI", func() {
+				Convey("With zero skips option", func() {
+					url, err := ip.Builder().
+						DPI(0).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/s-cFqOcqN4HMtEZQwoyp/plain/my/image.jpg")
+				})
+
+				Convey("Higher than zero sets the option", func() {
+					url, err := ip.Builder().
+						DPI(300).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/vgn-fPxxCQe69yL0GB5R/dpi:300/plain/my/image.jpg")
+				})
+			})
+
+			Convey("EnforceThumbnail sets the enforce thumbnail option", func() {
+				url, err := ip.Builder().
+					EnforceThumbnail(true).
+					Generate("my/image.heic")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/41eQNt7pnyU0i5V87jQs/eth:1/plain/my/image.heic")
+			})
+
+			Convey("FormatQuality sets the per format quality sorted by format", func() {
+				pairs := map[string]int{"webp": 65, "jpeg": 80, "avif": 50}
+
+				for n := 0; n < 10; n++ {
+					url, err := ip.Builder().
+						FormatQuality(pairs).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/IZPKL5K2cQbNBdsjNJ5a/fq:avif:50:jpeg:80:webp:65/plain/my/image.jpg")
+				}
+			})
+
+			Convey("ExportOptions round trips through GenerateFromExported", func() {
+				builder := ip.Builder().
+					Fill(300, 200).
+					Quality(80).
+					SetOption("Gravity", "sm")
+
+				exported := builder.ExportOptions()
+				So(exported, ShouldResemble, map[string]string{
+					"resize":  "fill:300:200:1:0",
+					"quality": "80",
+					"gravity": "sm",
+				})
+
+				expected, err := builder.Generate("my/image.jpg")
+				So(err, ShouldBeNil)
+
+				url, err := ip.GenerateFromExported(exported, "my/image.jpg")
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, expected)
+			})
+
+			Convey("Autoquality", func() {
+				Convey("Leaves out trailing zero arguments", func() {
+					url, err := ip.Builder().
+						Autoquality(AutoqualityDSSIM, 0.02, 0, 0).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/KE1CsONLbigCR8BPDC6K/aq:dssim:0.02/plain/my/image.jpg")
+				})
+
+				Convey("Sets all arguments", func() {
+					url, err := ip.Builder().
+						Autoquality(AutoqualityML, 0.015, 60, 90).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/-vPSMHwyeK1KFtY3_tnn/aq:ml:0.015:60:90/plain/my/image.jpg")
+				})
+			})
+
+			Convey("MaxBytes sets the max bytes option", func() {
+				url, err := ip.Builder().
+					MaxBytes(100 * 1024).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/4sGWav-xqORWGZkeM8KO/mb:102400/plain/my/image.jpg")
+			})
+
+			Convey("Advanced format options", func() {
+				Convey("JpegOptions leaves out trailing defaults", func() {
+					url, err := ip.Builder().
+						JpegOptions(JPEGOptions{Progressive: true, TrellisQuant: true}).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/qHtOMnmKcko65wrHqI8E/jpgo:1:0:1/plain/my/image.jpg")
+				})
+
+				Convey("JpegOptions keeps the order up to the last argument", func() {
+					url, err := ip.Builder().
+						JpegOptions(JPEGOptions{QuantTable: 3}).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/ITrnUZ5TbQPxmvTdBoSX/jpgo:0:0:0:0:0:3/plain/my/image.jpg")
+				})
+
+				Convey("PngOptions sets the option", func() {
+					url, err := ip.Builder().
+						PngOptions(PNGOptions{Quantize: true, QuantizationColors: 64}).
+						Generate("my/image.png")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/Zj8d-TPt1kwNZQ60PMRl/pngo:0:1:64/plain/my/image.png")
+				})
+
+				Convey("WebpOptions sets the option", func() {
+					url, err := ip.Builder().
+						WebpOptions(WebPOptions{Compression: WebPCompressionNearLossless, SmartSubsample: true}).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/b0DhhejA2-y8XWSeXq2l/webpo:near_lossless:1/plain/my/image.jpg")
+				})
+
+				Convey("Only defaults remove the option", func() {
+					builder := ip.Builder().
+						JpegOptions(JPEGOptions{Progressive: true}).
+						JpegOptions(JPEGOptions{}).
+						PngOptions(PNGOptions{}).
+						WebpOptions(WebPOptions{})
+
+					So(builder.Options, ShouldBeEmpty)
+				})
+			})
+
+			Convey("TinyBase64Hint", func() {
+				Convey("Generates a tiny low quality URL", func() {
+					url, err := ip.Builder().TinyBase64Hint("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/b2L4atk5bty0-GbgArzX/q:10/rs:fit:16:0:0:0/sm:1/plain/my/image.jpg")
+				})
+
+				Convey("Keeps the aspect ratio and leaves the builder untouched", func() {
+					builder := ip.Builder().Fill(300, 200)
+					url, err := builder.TinyBase64Hint("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/yDi6Y5GGunZeVnogZrKh/q:10/rs:fill:16:11:0:0/sm:1/plain/my/image.jpg")
+					So(builder.Options, ShouldHaveLength, 1)
+				})
+
+				Convey("Replaces the dimensions set by separate options", func() {
+					url, err := ip.Builder().
+						Fill(1600, 900).
+						Height(100).
+						Width(300).
+						TinyBase64Hint("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/rqYi1vVIUF6Oq27bwLeZ/q:10/rs:fill:16:48:0:0/sm:1/plain/my/image.jpg")
+				})
+
+				Convey("Drops the options scaling, padding or cropping the image", func() {
+					url, err := ip.Builder().
+						Fill(300, 200).
+						MinWidth(400).
+						DPR(2).
+						Zoom(1.5, 1.5).
+						Padding(10, 10, 10, 10).
+						Crop(100, 100, nil).
+						TinyBase64Hint("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/yDi6Y5GGunZeVnogZrKh/q:10/rs:fill:16:11:0:0/sm:1/plain/my/image.jpg")
+				})
+			})
+
+			Convey("Pages", func() {
+				Convey("Page sets the page option", func() {
+					url, err := ip.Builder().
+						Page(2).
+						Generate("my/document.pdf")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/26HGEbGZLjE6br08p1J0/pg:2/plain/my/document.pdf")
+				})
+
+				Convey("Pages sets the pages option", func() {
+					url, err := ip.Builder().
+						Page(1).
+						Pages(3).
+						Generate("my/document.pdf")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/tLmJnTvqldi2U-1eadcC/pg:1/pgs:3/plain/my/document.pdf")
+				})
+			})
+
+			Convey("Separates the options from the source with a single slash", func() {
+				Convey("Without options", func() {
+					url, err := ip.Builder().Generate("my/image.jpg")
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/s-cFqOcqN4HMtEZQwoyp/plain/my/image.jpg")
+
+					fast, err := ip.Builder().GenerateFast("my/image.jpg")
+					So(err, ShouldBeNil)
+					So(fast, ShouldEqual, url)
+				})
+
+				Convey("With several options", func() {
+					builder := ip.Builder().Width(300).Height(200).Quality(80)
+
+					So(builder.DryRun("my/image.jpg"), ShouldEqual, "/h:200/q:80/w:300/plain/my/image.jpg")
+
+					url, err := builder.Generate("my/image.jpg")
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/GXKapqhmKGgjmv69pACR/h:200/q:80/w:300/plain/my/image.jpg")
+				})
+
+				Convey("Keeps the source as given", func() {
+					So(ip.Builder().Width(300).DryRun("//cdn.example.com/a.jpg"), ShouldEqual, "/w:300/plain///cdn.example.com/a.jpg")
+				})
+			})
+
+			Convey("DisableAnimation", func() {
+				Convey("Disables the animation", func() {
+					url, err := ip.Builder().
+						DisableAnimation(true).
+						Generate("my/image.gif")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/HRPEiN1A9xU5fe7b2D8c/da:1/plain/my/image.gif")
+				})
+
+				Convey("Enables the animation", func() {
+					url, err := ip.Builder().
+						DisableAnimation(false).
+						Generate("my/image.gif")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/9fcczmgtoZIchC8GzTeS/da:0/plain/my/image.gif")
+				})
+			})
+
+			Convey("Letterbox", func() {
+				Convey("LetterboxTo fits, extends and sets the background", func() {
+					url, err := ip.Builder().
+						LetterboxTo(300, 200, HexColor("FFFFFF")).
+						Generate("my/image.png")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/3F4B-h0L8oFgKRWu-tA3/bg:FFFFFF/rs:fit:300:200:0:1/plain/my/image.png")
+				})
+
+				Convey("LetterboxTo extends through the resize option", func() {
+					builder := ip.Builder().
+						Extend(false, nil).
+						LetterboxTo(300, 200, HexColor("FFFFFF"))
+
+					path := builder.DryRun("my/image.png")
+					So(strings.Index(path, "/ex:0/"), ShouldBeLessThan, strings.Index(path, "/rs:fit:300:200:0:1/"))
+				})
+
+				Convey("LetterboxToFormat also sets the format", func() {
+					builder := ip.Builder().LetterboxToFormat(300, 200, HexColor("FFFFFF"), ImageFormatJPEG)
+
+					So(builder.Options, ShouldResemble, map[string]string{
+						"rs": "fit:300:200:0:1",
+						"bg": "FFFFFF",
+						"f":  "jpg",
+					})
+
+					url, err := builder.Generate("my/image.png")
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/rlkbR2bUJ6hpTh26qS3p/bg:FFFFFF/f:jpg/rs:fit:300:200:0:1/plain/my/image.png")
+				})
+			})
+
+			Convey("Video thumbnails", func() {
+				Convey("VideoThumbnailSecond sets the option", func() {
+					url, err := ip.Builder().
+						VideoThumbnailSecond(12.5).
+						Generate("my/video.mp4")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/4r23QWyrcjGIZfwdGOAW/vts:12.5/plain/my/video.mp4")
+				})
+
+				Convey("VideoThumbnailKeyframes sets the option", func() {
+					url, err := ip.Builder().
+						VideoThumbnailKeyframes(true).
+						Generate("my/video.mp4")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/2TWyIzsGbYzE68or2lj_/vtk:1/plain/my/video.mp4")
+				})
+
+				Convey("VideoThumbnailTile sets all tile arguments", func() {
+					url, err := ip.Builder().
+						VideoThumbnailTile(2.5, 4, 3, 160, 90, true, false).
+						Generate("my/video.mp4")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/yJ8y6Kkl6UQdA85XHmyx/vtt:2.5:4:3:160:90:1:0/plain/my/video.mp4")
+				})
+			})
+
+			Convey("FallbackImageURL sets the encoded fallback image url option", func() {
+				builder := ip.Builder().FallbackImageURL("https://example.com/fallback.png?v=2")
+
+				So(builder.Options["fiu"], ShouldEqual, "aHR0cHM6Ly9leGFtcGxlLmNvbS9mYWxsYmFjay5wbmc_dj0y")
+				So(builder.VerifyEncoding(), ShouldBeNil)
+			})
+
+			Convey("ExtractSource", func() {
+				allowed := map[string]bool{"images.example.com": true}
+
+				Convey("Returns a verified plain source", func() {
+					generated, err := ip.Builder().Width(300).Generate("https://images.example.com/my/image.jpg")
+					So(err, ShouldBeNil)
+
+					source, err := ip.ExtractSource(generated)
+					So(err, ShouldBeNil)
+					So(source, ShouldEqual, "https://images.example.com/my/image.jpg")
+
+					src, err := url.Parse(source)
+					So(err, ShouldBeNil)
+					So(allowed[src.Host], ShouldBeTrue)
+				})
+
+				Convey("Returns a verified encoded source", func() {
+					encoded, err := NewImgproxy(Config{
+						BaseURL:       "http://localhost",
+						SignatureSize: 15,
+						Key:           hex.EncodeToString([]byte("key")),
+						Salt:          hex.EncodeToString([]byte("salt")),
+						EncodePath:    true,
+					})
+					So(err, ShouldBeNil)
+
+					generated, err := encoded.Builder().Width(300).Generate("https://evil.example.org/my/image.jpg")
+					So(err, ShouldBeNil)
+
+					source, err := encoded.ExtractSource(generated)
+					So(err, ShouldBeNil)
+					So(source, ShouldEqual, "https://evil.example.org/my/image.jpg")
+
+					src, err := url.Parse(source)
+					So(err, ShouldBeNil)
+					So(allowed[src.Host], ShouldBeFalse)
+				})
+
+				Convey("Returns an unescaped plain source", func() {
+					source, err := ip.ExtractSource("http://localhost/R0Ord3pdkXZteZ9WoabO/w:300/plain/http%3A%2F%2Fevil.com%2Fa.jpg")
+					So(err, ShouldBeNil)
+					So(source, ShouldEqual, "http://evil.com/a.jpg")
+
+					src, err := url.Parse(source)
+					So(err, ShouldBeNil)
+					So(allowed[src.Host], ShouldBeFalse)
+				})
+
+				Convey("Ignores an unsigned trailing path", func() {
+					generated, err := ip.Builder().Width(300).TrailingPath("cdn/edge").Generate("https://images.example.com/my/image.jpg")
+					So(err, ShouldBeNil)
+
+					source, err := ip.ExtractSource(generated)
+					So(err, ShouldBeNil)
+					So(source, ShouldEqual, "https://images.example.com/my/image.jpg")
+				})
+
+				Convey("Returns error when the signature doesn't match", func() {
+					generated, err := ip.Builder().Width(300).Generate("https://images.example.com/my/image.jpg")
+					So(err, ShouldBeNil)
+
+					_, err = ip.ExtractSource(strings.Replace(generated, "w:300", "w:3000", 1))
+					So(errors.Cause(err), ShouldResemble, ErrSignatureMismatch)
+				})
+			})
+
+			Convey("SkipProcessing", func() {
+				Convey("With one format sets the option", func() {
+					url, err := ip.Builder().
+						SkipProcessing("svg").
+						Generate("my/image.svg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/upXpprfe-zh-fpqCGyw9/skp:svg/plain/my/image.svg")
+				})
+
+				Convey("With multiple formats sets the option", func() {
+					url, err := ip.Builder().
+						SkipProcessing("svg", "gif").
+						Generate("my/image.svg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/VfMzgmUJADJX9XifOQgp/skp:svg:gif/plain/my/image.svg")
+				})
+
+				Convey("Without formats skips option", func() {
+					url, err := ip.Builder().
+						SkipProcessing().
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/s-cFqOcqN4HMtEZQwoyp/plain/my/image.jpg")
+				})
+			})
+
+			Convey("Raw sets the raw option", func() {
+				url, err := ip.Builder().
+					Raw(true).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/SLteybcKZ7ht6JeX0ncY/raw:1/plain/my/image.jpg")
+			})
+
+			Convey("Expires sets the expires option to the unix timestamp", func() {
+				url, err := ip.Builder().
+					Expires(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/yRtzivyhsFI1YYbUd3Np/exp:1767225600/plain/my/image.jpg")
+			})
+
+			Convey("Filename", func() {
+				Convey("Sets the plain filename", func() {
+					url, err := ip.Builder().
+						Filename("report.pdf", false).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/KcKvOx7Gjha1k0Xo3xWi/fn:report.pdf/plain/my/image.jpg")
+				})
+
+				Convey("Sets the encoded filename with a slash", func() {
+					url, err := ip.Builder().
+						Filename("reports/2024.pdf", true).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/-F2DfutaassjLpv-3SuI/fn:cmVwb3J0cy8yMDI0LnBkZg:1/plain/my/image.jpg")
+				})
+			})
+
+			Convey("ReturnAttachment disabled sets the option", func() {
+				url, err := ip.Builder().
+					ReturnAttachment(false).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/XTtVaoGaWmHCzlgdPQ1n/att:0/plain/my/image.jpg")
+			})
+
+			Convey("Hashsum sets the algorithm and hash", func() {
+				url, err := ip.Builder().
+					Hashsum("sha256", "abc123").
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/NmvWU0Xdkhssb0jkc3Dj/hs:sha256:abc123/plain/my/image.jpg")
+			})
+
+			Convey("Source limits", func() {
+				Convey("MaxSrcResolution sets the option", func() {
+					url, err := ip.Builder().
+						MaxSrcResolution(16.5).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/mUUGnpulwpjmLKyBDqdj/msr:16.5/plain/my/image.jpg")
+				})
+
+				Convey("MaxSrcFileSize sets the option", func() {
+					url, err := ip.Builder().
+						MaxSrcFileSize(10 * 1024 * 1024).
+						Generate("my/image.jpg")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/f4sXmsHyS8l5E1dvH0EU/msfs:10485760/plain/my/image.jpg")
+				})
+
+				Convey("MaxAnimationFrames sets the option", func() {
+					url, err := ip.Builder().
+						MaxAnimationFrames(50).
+						Generate("my/image.gif")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/PCJFpEBv8SI7oRJdQ8S9/maf:50/plain/my/image.gif")
+				})
+
+				Convey("MaxAnimationFrameResolution sets the option", func() {
+					url, err := ip.Builder().
+						MaxAnimationFrameResolution(2.5).
+						Generate("my/image.gif")
+
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, "http://localhost/z2iaRNGxNbj5lDE8UCZQ/mafr:2.5/plain/my/image.gif")
+				})
+			})
+		})
+
+		Convey("Returns error when an option value exceeds MaxOptionValueLen", func() {
+			ip, err := NewImgproxy(Config{
+				BaseURL:           "http://localhost",
+				SignatureSize:     15,
+				Key:               hex.EncodeToString([]byte("key")),
+				Salt:              hex.EncodeToString([]byte("salt")),
+				MaxOptionValueLen: 8,
+			})
+			So(err, ShouldBeNil)
+
+			_, err = ip.Builder().
+				CacheBuster("0123456789").
+				Generate("my/image.jpg")
+			So(errors.Cause(err), ShouldResemble, ErrOptionValueTooLong)
+
+			_, err = ip.Builder().
+				CacheBuster("01234567").
+				Generate("my/image.jpg")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("With OmitResizeDefaults", func() {
+			cfg := Config{
+				BaseURL:            "http://localhost",
+				SignatureSize:      15,
+				Key:                hex.EncodeToString([]byte("key")),
+				Salt:               hex.EncodeToString([]byte("salt")),
+				OmitResizeDefaults: true,
+			}
+
+			trimmed, err := NewImgproxy(cfg)
+			So(err, ShouldBeNil)
+
+			cfg.OmitResizeDefaults = false
+			verbose, err := NewImgproxy(cfg)
+			So(err, ShouldBeNil)
+
+			Convey("Drops false enlarge and extend arguments", func() {
+				url, err := verbose.Builder().
+					Resize(ResizingTypeFill, 300, 200, false, false).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/DJAp0i1Xbu2Iqixxv2sj/rs:fill:300:200:0:0/plain/my/image.jpg")
+
+				url, err = trimmed.Builder().
+					Resize(ResizingTypeFill, 300, 200, false, false).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/fyLMmGTVOJ2tjcs3Psjo/rs:fill:300:200/plain/my/image.jpg")
+			})
+
+			Convey("Keeps enlarge when true", func() {
+				url, err := trimmed.Builder().
+					Resize(ResizingTypeFill, 300, 200, true, false).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/aXqaJ7xjR4GpCJk6CA8H/rs:fill:300:200:1/plain/my/image.jpg")
+			})
+		})
+
+		Convey("WithSigner delegates signing to the signer", func() {
+			ip, err := NewImgproxy(Config{
+				BaseURL:       "http://localhost",
+				SignatureSize: 15,
+			})
+			So(err, ShouldBeNil)
+
+			signer := &fakeSigner{}
+			url, err := ip.WithSigner(signer).Builder().
+				Width(100).
+				Generate("my/image.jpg")
+
+			So(err, ShouldBeNil)
+			So(signer.payload, ShouldEqual, "/w:100/plain/my/image.jpg")
+			So(url, ShouldEqual, "http://localhost/fake/w:100/plain/my/image.jpg")
+		})
+
+		Convey("With LongKeyOptions only renders the selected options long", func() {
+			ip, err := NewImgproxy(Config{
+				BaseURL:        "http://localhost",
+				SignatureSize:  15,
+				Key:            hex.EncodeToString([]byte("key")),
+				Salt:           hex.EncodeToString([]byte("salt")),
+				LongKeyOptions: map[string]bool{"resizing_type": true},
+			})
+			So(err, ShouldBeNil)
+
+			url, err := ip.Builder().
+				SetOption("rt", "fill").
+				Width(300).
+				Height(200).
+				Generate("my/image.jpg")
+
+			So(err, ShouldBeNil)
+			So(url, ShouldEqual, "http://localhost/0MVEcCTpvPMV1U-JoLe6/h:200/resizing_type:fill/w:300/plain/my/image.jpg")
+		})
+
+		Convey("Encodes the source with URL-safe base64", func() {
+			ip, err := NewImgproxy(Config{
+				BaseURL:       "http://localhost",
+				SignatureSize: 15,
+				Key:           hex.EncodeToString([]byte("key")),
+				Salt:          hex.EncodeToString([]byte("salt")),
+				EncodePath:    true,
+			})
+			So(err, ShouldBeNil)
+
+			path := ip.Builder().OptionsPath("http://example.com/images/photo.jpg?w=>>>&h=???")
+
+			So(path, ShouldStartWith, "/")
+			So(path[1:], ShouldNotContainSubstring, "+")
+			So(path[1:], ShouldNotContainSubstring, "/")
+		})
+
+		Convey("Uses - and _ where standard base64 would use + and /", func() {
+			ip, err := NewImgproxy(Config{
+				BaseURL:       "http://localhost",
+				SignatureSize: 15,
+				Key:           hex.EncodeToString([]byte("key")),
+				Salt:          hex.EncodeToString([]byte("salt")),
+				EncodePath:    true,
+			})
+			So(err, ShouldBeNil)
+
+			url, err := ip.Builder().Generate("http://example.com/images/photo.jpg?w=>>>&h=???")
+			So(err, ShouldBeNil)
+			So(url, ShouldEqual, "http://localhost/dq3-GekivMjNZ8vgkXGW/aHR0cDovL2V4YW1wbGUuY29tL2ltYWdlcy9waG90by5qcGc_dz0-Pj4maD0_Pz8")
+		})
+
+		Convey("With SignTrailingPath signs the trailing path", func() {
+			ip, err := NewImgproxy(Config{
+				BaseURL:          "http://localhost",
+				SignatureSize:    15,
+				Key:              hex.EncodeToString([]byte("key")),
+				Salt:             hex.EncodeToString([]byte("salt")),
+				SignTrailingPath: true,
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Appends it to the plain source", func() {
+				url, err := ip.Builder().
+					Width(100).
+					TrailingPath("cdn/edge").
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/K4AEb41lGOBlaeKI6LfW/w:100/plain/my/image.jpg/cdn/edge")
+			})
+
+			Convey("Inserts it before the extension", func() {
+				builder := ip.Builder().
+					Width(100).
+					Extension("png").
+					TrailingPath("cdn/edge")
+
+				url, err := builder.Generate("my/image.jpg")
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/Nu1qm3VnGRDHniGzHg82/w:100/plain/my/image.jpg/cdn/edge@png")
+
+				fast, err := builder.GenerateFast("my/image.jpg")
+				So(err, ShouldBeNil)
+				So(fast, ShouldEqual, url)
+
+				_, source, err := ip.ParseURL(url)
+				So(err, ShouldBeNil)
+				So(source, ShouldEqual, "my/image.jpg/cdn/edge")
+			})
+
+			Convey("Returns error with an encoded source", func() {
+				encoded, err := NewImgproxy(Config{
+					BaseURL:          "http://localhost",
+					SignatureSize:    15,
+					Key:              hex.EncodeToString([]byte("key")),
+					Salt:             hex.EncodeToString([]byte("salt")),
+					SignTrailingPath: true,
+					EncodePath:       true,
+				})
+				So(err, ShouldBeNil)
+
+				_, err = encoded.Builder().
+					Width(100).
+					TrailingPath("cdn/edge").
+					Generate("my/image.jpg")
+				So(errors.Cause(err), ShouldResemble, ErrSignedTrailingPathEncoded)
+
+				_, err = encoded.Builder().
+					Width(100).
+					TrailingPath("cdn/edge").
+					GenerateFast("my/image.jpg")
+				So(errors.Cause(err), ShouldResemble, ErrSignedTrailingPathEncoded)
+
+				_, err = ip.Builder().
+					DataURISource("image/png", []byte("png")).
+					TrailingPath("cdn/edge").
+					Generate("")
+				So(errors.Cause(err), ShouldResemble, ErrSignedTrailingPathEncoded)
+			})
+		})
+
+		Convey("With SortByLongName orders options by their long name", func() {
+			cfg := Config{
+				BaseURL:        "http://localhost",
+				SignatureSize:  15,
+				Key:            hex.EncodeToString([]byte("key")),
+				Salt:           hex.EncodeToString([]byte("salt")),
+				SortByLongName: true,
+			}
+
+			short, err := NewImgproxy(cfg)
+			So(err, ShouldBeNil)
+
+			cfg.LongKeyOptions = map[string]bool{"return_attachment": true}
+			long, err := NewImgproxy(cfg)
+			So(err, ShouldBeNil)
+
+			url, err := short.Builder().
+				DownloadAs("invoice.png").
+				Generate("my/image.jpg")
+
+			So(err, ShouldBeNil)
+			So(url, ShouldEqual, "http://localhost/vK0GQRaz9uGzGQzI7DZq/fn:invoice.png/att:1/plain/my/image.jpg")
+
+			url, err = long.Builder().
+				DownloadAs("invoice.png").
+				Generate("my/image.jpg")
+
+			So(err, ShouldBeNil)
+			So(url, ShouldEqual, "http://localhost/Wh6PhS4T7Ufz9Z4IpjqC/fn:invoice.png/return_attachment:1/plain/my/image.jpg")
+		})
+
+		Convey("GenerateFast matches Generate", func() {
+			for _, cfg := range []Config{
+				{BaseURL: "http://localhost", SignatureSize: 15, Key: hex.EncodeToString([]byte("key")), Salt: hex.EncodeToString([]byte("salt"))},
+				{BaseURL: "http://localhost", SignatureSize: 15, Key: hex.EncodeToString([]byte("key")), Salt: hex.EncodeToString([]byte("salt")), EncodePath: true},
+				{BaseURL: "http://localhost", SignatureSize: 32, SignTrailingPath: true},
+				{BaseURL: "http://localhost", SignatureSize: 15, LongKeyOptions: map[string]bool{"width": true}},
+			} {
+				ip, err := NewImgproxy(cfg)
+				So(err, ShouldBeNil)
+
+				for _, builder := range []*ImgproxyURLData{
+					ip.Builder(),
+					ip.Builder().Width(300),
+					ip.Builder().Fill(300, 200).Quality(80).Format("webp"),
+					ip.Builder().Fit(300, 200).Gravity(GravityEnumSmart).Extension("png"),
+					ip.Builder().Width(300).Scheme("https").QueryCacheBust("v2"),
+				} {
+					expected, err := builder.Generate("my/image.jpg")
+					So(err, ShouldBeNil)
+
+					url, err := builder.GenerateFast("my/image.jpg")
+					So(err, ShouldBeNil)
+					So(url, ShouldEqual, expected)
+				}
+			}
+		})
+
+		Convey("With TargetVersion Validate rejects options of newer versions", func() {
+			cfg := Config{
+				BaseURL:       "http://localhost",
+				SignatureSize: 15,
+				TargetVersion: 2,
+			}
+
+			v2, err := NewImgproxy(cfg)
+			So(err, ShouldBeNil)
+
+			cfg.TargetVersion = 3
+			v3, err := NewImgproxy(cfg)
+			So(err, ShouldBeNil)
+
+			issues := v2.Builder().Width(100).Zoom(2, 2).Validate()
+			So(issues, ShouldHaveLength, 1)
+			So(errors.Cause(issues[0]), ShouldResemble, ErrUnsupportedOption)
+
+			So(v3.Builder().Width(100).Zoom(2, 2).Validate(), ShouldBeEmpty)
+		})
+
+		Convey("With UnsignedOptions passes them in the query string", func() {
+			ip, err := NewImgproxy(Config{
+				BaseURL:         "http://localhost",
+				SignatureSize:   15,
+				Key:             hex.EncodeToString([]byte("key")),
+				Salt:            hex.EncodeToString([]byte("salt")),
+				UnsignedOptions: map[string]bool{"cachebuster": true},
+			})
+			So(err, ShouldBeNil)
+
+			Convey("Leaves them out of the signed path", func() {
+				url, err := ip.Builder().
+					Width(100).
+					CacheBuster("dev").
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/DrneV2BWFeLEQo8c7L84/w:100/plain/my/image.jpg?cb=dev")
+			})
+
+			Convey("Returns error when cachebuster clashes with QueryCacheBust", func() {
+				_, err := ip.Builder().
+					CacheBuster("dev").
+					QueryCacheBust("v2").
+					Generate("my/image.jpg")
+
+				So(errors.Cause(err), ShouldResemble, ErrQueryConflict)
+			})
+
+			Convey("Canonicalize keeps them in the query string", func() {
+				generated, err := ip.Builder().
+					Width(100).
+					CacheBuster("dev").
+					Generate("my/image.jpg")
+				So(err, ShouldBeNil)
+
+				url, err := ip.Canonicalize(generated)
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, generated)
+			})
+		})
+
+		Convey("With a fixed clock", func() {
+			now := time.Date(2025, 12, 31, 23, 0, 0, 0, time.UTC)
+			ip, err := NewImgproxy(Config{
+				BaseURL:       "http://localhost",
+				SignatureSize: 15,
+				Key:           hex.EncodeToString([]byte("key")),
+				Salt:          hex.EncodeToString([]byte("salt")),
+				Clock: func() time.Time {
+					return now
+				},
+			})
+
+			So(err, ShouldBeNil)
+
+			Convey("ExpiresIn sets the expiration relative to the clock", func() {
+				url, err := ip.Builder().
+					ExpiresIn(time.Hour).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(url, ShouldEqual, "http://localhost/yRtzivyhsFI1YYbUd3Np/exp:1767225600/plain/my/image.jpg")
+			})
+
+			Convey("IsExpired compares the expiration to the clock", func() {
+				builder := ip.Builder().ExpiresIn(time.Hour)
+				So(builder.IsExpired(), ShouldBeFalse)
+
+				now = now.Add(time.Hour)
+				So(builder.IsExpired(), ShouldBeTrue)
+			})
+
+			Convey("IsExpired is false without expiration", func() {
+				So(ip.Builder().IsExpired(), ShouldBeFalse)
+			})
+		})
+
+		Convey("With WarnDeprecated", func() {
+			var warned []string
+			ip, err := NewImgproxy(Config{
+				BaseURL:       "http://localhost",
+				SignatureSize: 15,
+				Key:           hex.EncodeToString([]byte("key")),
+				Salt:          hex.EncodeToString([]byte("salt")),
+				WarnDeprecated: func(option string) {
+					warned = append(warned, option)
+				},
+			})
+
+			So(err, ShouldBeNil)
+
+			Convey("Calls the callback for a deprecated option", func() {
+				_, err := ip.Builder().
+					SetOption("unsharpening", "always").
+					Width(100).
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(warned, ShouldResemble, []string{"unsharpening"})
+			})
+
+			Convey("Doesn't call the callback without deprecated options", func() {
+				_, err := ip.Builder().
+					UnsharpMasking(UnsharpMaskingModeAlways, 0, 0).
+					GenerateFast("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(warned, ShouldBeEmpty)
+			})
+		})
+
+		Convey("With StrictOptions", func() {
+			ip, err := NewImgproxy(Config{
+				BaseURL:       "http://localhost",
+				SignatureSize: 15,
+				Key:           hex.EncodeToString([]byte("key")),
+				Salt:          hex.EncodeToString([]byte("salt")),
+				StrictOptions: true,
+			})
+
+			So(err, ShouldBeNil)
+
+			Convey("Returns error for a misspelled option", func() {
+				_, err := ip.Builder().
+					SetOption("widht", "100").
+					SetOption("hieght", "100").
+					Generate("my/image.jpg")
+
+				So(errors.Cause(err), ShouldResemble, ErrUnknownOption)
+				So(err.Error(), ShouldContainSubstring, "hieght, widht")
+			})
+
+			Convey("Accepts known options by long or short name", func() {
+				_, err := ip.Builder().
+					SetOption("width", "100").
+					SetOption("h", "100").
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Accepts a deprecated option and warns about it", func() {
+				var warned []string
+				deprecated, err := NewImgproxy(Config{
+					BaseURL:       "http://localhost",
+					SignatureSize: 15,
+					StrictOptions: true,
+					WarnDeprecated: func(option string) {
+						warned = append(warned, option)
+					},
+				})
+				So(err, ShouldBeNil)
+
+				_, err = deprecated.Builder().
+					SetOption("unsharpening", "always").
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+				So(warned, ShouldResemble, []string{"unsharpening"})
+			})
+
+			Convey("Passes a misspelled option without strict mode", func() {
+				lenient, err := NewImgproxy(Config{
+					BaseURL:       "http://localhost",
+					SignatureSize: 15,
+				})
+				So(err, ShouldBeNil)
+
+				_, err = lenient.Builder().
+					SetOption("widht", "100").
+					Generate("my/image.jpg")
+
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
+
+type fakeSigner struct {
+	payload string
+}
+
+func (s *fakeSigner) Sign(payload string) (string, error) {
+	s.payload = payload
+	return "fake", nil
+}
+
+func FuzzParseURL(f *testing.F) {
+	ip, err := NewImgproxy(Config{
+		BaseURL:       "http://localhost",
+		SignatureSize: 15,
+		Key:           hex.EncodeToString([]byte("key")),
+		Salt:          hex.EncodeToString([]byte("salt")),
+	})
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	for _, seed := range []string{
+		"http://localhost/T0ConuLHyLnlO4IUVQqd/rs:fit:123:456:1:0/plain/my/image.jpg",
+		"http://localhost/6wIzqvuZtfHT1LL3J_z0/bXkvaW1hZ2UuanBn",
+		"http://localhost/6wIzqvuZtfHT1LL3J_z0/bXkvaW1hZ2UuanB",
+		"http://localhost/6wIzqvuZtfHT1LL3J_z0/w:1/bXkv/aW1h/Z2Uu/anBn.png",
+		"http://localhost/w:1/plain/",
+		"http://localhost//w:1//plain/my/image.jpg@",
+		"http://localhost/sig/:1/plain/a",
+		"http://localhost/",
+		"http://localhost",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, fullURL string) {
+		builder, source, err := ip.ParseURL(fullURL)
+		if err != nil {
+			return
+		}
+
+		if builder == nil || source == "" {
+			t.Fatalf("ParseURL(%q) returned no builder or source without error", fullURL)
+		}
+	})
+}
+
+func benchmarkBuilder(b *testing.B) *ImgproxyURLData {
+	ip, err := NewImgproxy(Config{
+		BaseURL:       "http://localhost",
+		SignatureSize: 15,
+		Key:           hex.EncodeToString([]byte("key")),
+		Salt:          hex.EncodeToString([]byte("salt")),
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	return ip.Builder().Fill(300, 200).Quality(80)
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	builder := benchmarkBuilder(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if _, err := builder.Generate("my/image.jpg"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGenerateFast(b *testing.B) {
+	builder := benchmarkBuilder(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if _, err := builder.GenerateFast("my/image.jpg"); err != nil {
+			b.Fatal(err)
+		}
+	}
 }
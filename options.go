@@ -0,0 +1,164 @@
+package imgproxy
+
+import "strings"
+
+// allOptions lists the processing options supported by imgproxy, with their long and short names.
+var allOptions = []struct {
+	long  string
+	short string
+}{
+	{"resize", "rs"},
+	{"size", "s"},
+	{"resizing_type", "rt"},
+	{"resizing_algorithm", "ra"},
+	{"width", "w"},
+	{"height", "h"},
+	{"min_width", "mw"},
+	{"min_height", "mh"},
+	{"zoom", "z"},
+	{"dpr", "dpr"},
+	{"enlarge", "el"},
+	{"extend", "ex"},
+	{"extend_aspect_ratio", "exar"},
+	{"gravity", "g"},
+	{"crop", "c"},
+	{"trim", "t"},
+	{"padding", "pd"},
+	{"auto_rotate", "ar"},
+	{"rotate", "rot"},
+	{"background", "bg"},
+	{"background_alpha", "bga"},
+	{"adjust", "a"},
+	{"brightness", "br"},
+	{"contrast", "co"},
+	{"saturation", "sa"},
+	{"blur", "bl"},
+	{"sharpen", "sh"},
+	{"pixelate", "pix"},
+	{"unsharp_masking", "ush"},
+	{"blur_detections", "bd"},
+	{"draw_detections", "dd"},
+	{"gradient", "gr"},
+	{"watermark", "wm"},
+	{"watermark_url", "wmu"},
+	{"watermark_text", "wmt"},
+	{"watermark_size", "wms"},
+	{"watermark_rotate", "wmr"},
+	{"watermark_shadow", "wmsh"},
+	{"style", "st"},
+	{"strip_metadata", "sm"},
+	{"keep_copyright", "kcr"},
+	{"dpi", "dpi"},
+	{"strip_color_profile", "scp"},
+	{"enforce_thumbnail", "eth"},
+	{"quality", "q"},
+	{"format_quality", "fq"},
+	{"autoquality", "aq"},
+	{"max_bytes", "mb"},
+	{"jpeg_options", "jpgo"},
+	{"png_options", "pngo"},
+	{"webp_options", "webpo"},
+	{"format", "f"},
+	{"page", "pg"},
+	{"pages", "pgs"},
+	{"disable_animation", "da"},
+	{"video_thumbnail_second", "vts"},
+	{"video_thumbnail_keyframes", "vtk"},
+	{"video_thumbnail_tile", "vtt"},
+	{"fallback_image_url", "fiu"},
+	{"skip_processing", "skp"},
+	{"cachebuster", "cb"},
+	{"expires", "exp"},
+	{"filename", "fn"},
+	{"return_attachment", "att"},
+	{"preset", "pr"},
+	{"hashsum", "hs"},
+	{"max_src_resolution", "msr"},
+	{"max_src_file_size", "msfs"},
+	{"max_animation_frames", "maf"},
+	{"max_animation_frame_resolution", "mafr"},
+	{"raw", "raw"},
+}
+
+// optionVersions holds the major imgproxy version known to have introduced an option, by long name.
+// It isn't exhaustive: options missing from it aren't checked by Validate, even when a newer version added them.
+var optionVersions = map[string]int{
+	"min_width":           3,
+	"min_height":          3,
+	"zoom":                3,
+	"extend_aspect_ratio": 3,
+	"format_quality":      3,
+	"autoquality":         3,
+	"raw":                 3,
+}
+
+// deprecatedOptions maps the deprecated options, by name as set on the builder, to the option replacing them.
+var deprecatedOptions = map[string]string{
+	"unsharpening": "unsharp_masking",
+}
+
+// longOptionNames maps the short name of an option to its long name.
+var longOptionNames = func() map[string]string {
+	names := make(map[string]string, len(allOptions))
+	for _, option := range allOptions {
+		names[option.short] = option.long
+	}
+
+	return names
+}()
+
+// longOptionName returns the long name of an option, or the given key when it's unknown.
+func longOptionName(key string) string {
+	if long, ok := longOptionNames[key]; ok {
+		return long
+	}
+
+	return key
+}
+
+// shortOptionNames maps the long name of an option to its short name.
+var shortOptionNames = func() map[string]string {
+	names := make(map[string]string, len(allOptions))
+	for _, option := range allOptions {
+		names[option.long] = option.short
+	}
+
+	return names
+}()
+
+// shortOptionName returns the short name of an option, or the given key when it's unknown.
+func shortOptionName(key string) string {
+	if short, ok := shortOptionNames[key]; ok {
+		return short
+	}
+
+	return key
+}
+
+// canonicalOptionName returns the short name of a known option given its long or short name in any case,
+// or the given key when it's unknown.
+func canonicalOptionName(key string) string {
+	lower := strings.ToLower(key)
+
+	if short, ok := shortOptionNames[lower]; ok {
+		return short
+	}
+
+	if _, ok := longOptionNames[lower]; ok {
+		return lower
+	}
+
+	return key
+}
+
+// SupportedOptions returns the long and short names of the processing options supported by imgproxy,
+// e.g. for autocompletion. The returned slice is a copy and may be modified freely.
+func SupportedOptions() []struct{ Long, Short string } {
+	options := make([]struct{ Long, Short string }, len(allOptions))
+	for idx, option := range allOptions {
+		options[idx].Long = option.long
+		options[idx].Short = option.short
+	}
+
+	return options
+}
@@ -0,0 +1,202 @@
+package imgproxy
+
+import (
+	"crypto/hmac"
+	"encoding/base64"
+	stdErrs "errors"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidURL error.
+var ErrInvalidURL = stdErrs.New("invalid imgproxy url")
+
+// redacted replaces the signatures removed by RedactSignature.
+const redacted = "***"
+
+// ErrSignatureMismatch error.
+var ErrSignatureMismatch = stdErrs.New("signature mismatch")
+
+// ParseURL parses an imgproxy URL starting with the configured base URL.
+// It returns a builder holding the URL options and the decoded source URI.
+// Plain sources are unescaped, like imgproxy does.
+func (i *Imgproxy) ParseURL(fullURL string) (*ImgproxyURLData, string, error) {
+	if !strings.HasPrefix(fullURL, i.cfg.BaseURL) {
+		return nil, "", errors.Wrap(ErrInvalidURL, "base url mismatch")
+	}
+
+	parts := strings.Split(strings.TrimPrefix(fullURL, i.cfg.BaseURL), "/")
+	if len(parts) < 2 {
+		return nil, "", errors.Wrap(ErrInvalidURL, "missing source")
+	}
+
+	if parts[0] == "" {
+		return nil, "", errors.Wrap(ErrInvalidURL, "missing signature")
+	}
+
+	builder := i.Builder()
+	parts = parts[1:]
+
+	for len(parts) > 0 && parts[0] != "plain" && strings.Contains(parts[0], ":") {
+		key, value, _ := strings.Cut(parts[0], ":")
+		if key == "" {
+			return nil, "", errors.Wrap(ErrInvalidURL, "empty option name")
+		}
+
+		builder.SetOption(shortOptionName(key), value)
+		parts = parts[1:]
+	}
+
+	if len(parts) == 0 || parts[0] == "" {
+		return nil, "", errors.Wrap(ErrInvalidURL, "missing source")
+	}
+
+	var source, extension string
+
+	if parts[0] == "plain" {
+		escaped := strings.Join(parts[1:], "/")
+		if idx := strings.LastIndex(escaped, "@"); idx >= 0 {
+			escaped, extension = escaped[:idx], escaped[idx+1:]
+		}
+
+		// Escaped sources are regenerated encoded, so they stay intact.
+		var err error
+		if source, err = url.PathUnescape(escaped); err != nil {
+			return nil, "", errors.Wrap(ErrInvalidURL, err.Error())
+		}
+
+		builder.encodeSource = source != escaped
+	} else {
+		encoded := strings.Join(parts, "")
+		if idx := strings.LastIndex(encoded, "."); idx >= 0 {
+			encoded, extension = encoded[:idx], encoded[idx+1:]
+		}
+
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+		if err != nil {
+			return nil, "", errors.Wrap(ErrInvalidURL, err.Error())
+		}
+
+		source = string(decoded)
+		builder.encodeSource = true
+	}
+
+	if source == "" {
+		return nil, "", errors.Wrap(ErrInvalidURL, "missing source")
+	}
+
+	builder.Extension(extension)
+
+	return builder, source, builder.err
+}
+
+// Canonicalize parses an imgproxy URL and generates it again,
+// so equivalent URLs with options in a different order or with long names result in the same URL.
+// When a key or salt is configured, the signature is verified first, so only validly signed URLs are signed again.
+// The query string and an unsigned trailing path are kept, matching QueryCacheBust, UnsignedOptions and TrailingPath.
+func (i *Imgproxy) Canonicalize(fullURL string) (string, error) {
+	signed, trailingPath, query, err := i.splitSigned(fullURL)
+	if err != nil {
+		return "", err
+	}
+
+	builder, source, err := i.ParseURL(signed)
+	if err != nil {
+		return "", err
+	}
+
+	if trailingPath != "" {
+		builder.TrailingPath(trailingPath)
+	}
+
+	for key, values := range query {
+		if option := canonicalOptionName(key); i.cfg.UnsignedOptions[longOptionName(option)] {
+			builder.SetOption(option, values[0])
+		} else if key == "cb" {
+			builder.QueryCacheBust(values[0])
+		}
+	}
+
+	return builder.Generate(source)
+}
+
+// splitSigned splits an imgproxy URL into its signed part, the unsigned trailing path and the query string,
+// verifying the signature when a key or salt is configured. Without them, any signature is accepted
+// and an unsigned trailing path can't be told apart from the source.
+func (i *Imgproxy) splitSigned(fullURL string) (signed string, trailingPath string, query url.Values, err error) {
+	fullURL, rawQuery, _ := strings.Cut(fullURL, "?")
+	if query, err = url.ParseQuery(rawQuery); err != nil {
+		return "", "", nil, errors.Wrap(ErrInvalidURL, err.Error())
+	}
+
+	if !strings.HasPrefix(fullURL, i.cfg.BaseURL) {
+		return "", "", nil, errors.Wrap(ErrInvalidURL, "base url mismatch")
+	}
+
+	signature, payload, _ := strings.Cut(strings.TrimPrefix(fullURL, i.cfg.BaseURL), "/")
+	if signature == "" {
+		return "", "", nil, errors.Wrap(ErrInvalidURL, "missing signature")
+	}
+
+	if i.signer == nil {
+		return fullURL, "", query, nil
+	}
+
+	// An unsigned trailing path follows the signed path, try the longest candidate first.
+	for candidate := payload; ; {
+		expected, err := i.signer.Sign("/" + candidate)
+		if err != nil {
+			return "", "", nil, err
+		}
+
+		if hmac.Equal([]byte(signature), []byte(expected)) {
+			return i.cfg.BaseURL + signature + "/" + candidate, payload[len(candidate):], query, nil
+		}
+
+		idx := strings.LastIndexByte(candidate, '/')
+		if i.cfg.SignTrailingPath || idx < 0 {
+			return "", "", nil, errors.WithStack(ErrSignatureMismatch)
+		}
+
+		candidate = candidate[:idx]
+	}
+}
+
+// ExtractSource returns the decoded source URI of an imgproxy URL, plain or base64 encoded,
+// e.g. for a gateway to log or allowlist the source hosts. When a key or salt is configured,
+// the signature is verified first. The query string and an unsigned trailing path are ignored.
+func (i *Imgproxy) ExtractSource(fullURL string) (string, error) {
+	signed, _, _, err := i.splitSigned(fullURL)
+	if err != nil {
+		return "", err
+	}
+
+	_, source, err := i.ParseURL(signed)
+	if err != nil {
+		return "", err
+	}
+
+	return source, nil
+}
+
+// RedactSignature replaces the signature of an imgproxy URL with ***, for safe logging.
+// The signature is expected right after the configured base URL, so base URLs with a path prefix are supported.
+// URLs of another base URL are fully redacted, so a signature is never logged by mistake.
+func (i *Imgproxy) RedactSignature(fullURL string) string {
+	if !strings.HasPrefix(fullURL, i.cfg.BaseURL) {
+		return redacted
+	}
+
+	rest := strings.TrimPrefix(fullURL, i.cfg.BaseURL)
+	if rest == "" {
+		return fullURL
+	}
+
+	if _, path, ok := strings.Cut(rest, "/"); ok {
+		return i.cfg.BaseURL + redacted + "/" + path
+	}
+
+	return i.cfg.BaseURL + redacted
+}
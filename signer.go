@@ -0,0 +1,56 @@
+package imgproxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"hash"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Signer computes the signature of an imgproxy URL path.
+type Signer interface {
+	Sign(payload string) (string, error)
+}
+
+// hmacSigner is the default Signer, signing in process with the configured key and salt.
+// HMAC instances are pooled, as setting one up is the most expensive part of signing short payloads.
+type hmacSigner struct {
+	salt          []byte
+	signatureSize int
+	pool          *sync.Pool
+}
+
+func newHMACSigner(key []byte, salt []byte, signatureSize int) hmacSigner {
+	return hmacSigner{
+		salt:          salt,
+		signatureSize: signatureSize,
+		pool: &sync.Pool{
+			New: func() interface{} {
+				return hmac.New(sha256.New, key)
+			},
+		},
+	}
+}
+
+// Sign signs the payload.
+func (s hmacSigner) Sign(payload string) (string, error) {
+	signature := s.pool.Get().(hash.Hash)
+	defer s.pool.Put(signature)
+
+	signature.Reset()
+
+	if _, err := signature.Write(s.salt); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if _, err := signature.Write([]byte(payload)); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	sha := base64.RawURLEncoding.EncodeToString(signature.Sum(nil)[:s.signatureSize])
+
+	return sha, nil
+}
@@ -0,0 +1,86 @@
+package imgproxy
+
+import (
+	stdErrs "errors"
+
+	"github.com/pkg/errors"
+)
+
+// ErrInvalidTransformSpec error.
+var ErrInvalidTransformSpec = stdErrs.New("invalid transform spec")
+
+// TransformSpec describes a set of transformations to apply on a builder.
+// Zero values are left unset.
+type TransformSpec struct {
+	ResizingType ResizingType
+	Width        int
+	Height       int
+	Gravity      GravitySetter
+	Quality      int
+	Format       ImageFormat
+	Options      map[string]string
+}
+
+// Apply applies the spec on the builder.
+// An invalid spec makes Generate return an error.
+func (s TransformSpec) Apply(i *ImgproxyURLData) *ImgproxyURLData {
+	if s.Width < 0 || s.Height < 0 {
+		return i.setError(errors.Wrap(ErrInvalidTransformSpec, "negative dimensions"))
+	}
+
+	if s.Quality < 0 || s.Quality > 100 {
+		return i.setError(errors.Wrapf(ErrInvalidTransformSpec, "quality %d out of range", s.Quality))
+	}
+
+	if s.ResizingType != "" {
+		i.ResizingType(s.ResizingType)
+	}
+
+	if s.Width > 0 {
+		i.Width(s.Width)
+	}
+
+	if s.Height > 0 {
+		i.Height(s.Height)
+	}
+
+	if s.Gravity != nil {
+		i.Gravity(s.Gravity)
+	}
+
+	if s.Quality > 0 {
+		i.Quality(s.Quality)
+	}
+
+	if s.Format != "" {
+		i.Format(string(s.Format))
+	}
+
+	for key, value := range s.Options {
+		i.SetOption(key, value)
+	}
+
+	return i
+}
+
+// BatchItem holds a source URI and the transformations to apply on it.
+type BatchItem struct {
+	URI  string
+	Spec TransformSpec
+}
+
+// GenerateBatch generates a signed URL for each item, stopping at the first item that fails.
+func (i *Imgproxy) GenerateBatch(items []BatchItem) ([]string, error) {
+	urls := make([]string, len(items))
+
+	for idx, item := range items {
+		url, err := item.Spec.Apply(i.Builder()).Generate(item.URI)
+		if err != nil {
+			return nil, errors.Wrapf(err, "batch item %d (%s)", idx, item.URI)
+		}
+
+		urls[idx] = url
+	}
+
+	return urls, nil
+}
@@ -1,13 +1,16 @@
 package imgproxy
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
 	"encoding/base64"
+	stdErrs "errors"
 	"fmt"
+	"math"
+	"net/url"
+	"path"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -15,60 +18,314 @@ import (
 // ImgproxyURLData is a struct that contains the data required for generating an imgproxy URL.
 type ImgproxyURLData struct {
 	*Imgproxy
-	Options map[string]string
+	Options      map[string]string
+	source       string
+	encodeSource bool
+	extension    string
+	scheme       string
+	queryBuster  string
+	trailingPath string
+	parent       *ImgproxyURLData
+	err          error
 }
 
 const insecureSignature = "insecure"
 
+// ErrEmptySource error.
+var ErrEmptySource = stdErrs.New("empty source uri")
+
+// ErrInvalidEncoding error.
+var ErrInvalidEncoding = stdErrs.New("invalid option value encoding")
+
+// ErrFormatConflict error.
+var ErrFormatConflict = stdErrs.New("both format option and source extension are set")
+
+// ErrInvalidScheme error.
+var ErrInvalidScheme = stdErrs.New("scheme must be http or https")
+
+// ErrEmptyFormatList error.
+var ErrEmptyFormatList = stdErrs.New("empty format list")
+
+// ErrInvalidRotation error.
+var ErrInvalidRotation = stdErrs.New("rotation angle must be 0, 90, 180 or 270")
+
+// ErrInvalidAspectRatio error.
+var ErrInvalidAspectRatio = stdErrs.New("aspect ratio must be positive")
+
+// ErrOptionValueTooLong error.
+var ErrOptionValueTooLong = stdErrs.New("option value too long")
+
+// ErrSignedTrailingPathEncoded error.
+var ErrSignedTrailingPathEncoded = stdErrs.New("signed trailing path can't be combined with an encoded source")
+
+// ErrQueryConflict error.
+var ErrQueryConflict = stdErrs.New("both unsigned cachebuster option and query cache bust are set")
+
+// ErrUnknownOption error.
+var ErrUnknownOption = stdErrs.New("unknown option")
+
 // Generate generates the imgproxy URL.
+// An empty uri uses the source set on the builder, e.g. by DataURISource.
 func (i *ImgproxyURLData) Generate(uri string) (string, error) {
-	if i.cfg.EncodePath {
-		uri = base64.RawStdEncoding.EncodeToString([]byte(uri))
+	uri, err := i.resolveSource(uri)
+	if err != nil {
+		return "", err
+	}
+
+	i.warnDeprecated()
+
+	uriWithOptions := i.OptionsPath(uri)
+
+	signature := insecureSignature
+	if i.signer != nil {
+		if signature, err = i.signer.Sign(uriWithOptions); err != nil {
+			return "", err
+		}
+	}
+
+	if !i.cfg.SignTrailingPath {
+		uriWithOptions += i.trailingPath
+	}
+
+	return i.baseURL() + signature + uriWithOptions + i.query(), nil
+}
+
+// AsCurl returns a curl command requesting the headers of the generated URL, for manual testing against the server.
+func (i *ImgproxyURLData) AsCurl(uri string) (string, error) {
+	generated, err := i.Generate(uri)
+	if err != nil {
+		return "", err
+	}
+
+	return "curl -I '" + strings.ReplaceAll(generated, "'", `'\''`) + "'", nil
+}
+
+// OptionsPath returns the unsigned /options/source path of the URL, the payload signed by Generate.
+func (i *ImgproxyURLData) OptionsPath(uri string) string {
+	if i.cfg.EncodePath || i.encodeSource {
+		uri = base64.RawURLEncoding.EncodeToString([]byte(uri))
+		if i.extension != "" {
+			uri += "." + i.extension
+		}
 	} else {
 		uri = "plain/" + uri
+		if i.cfg.SignTrailingPath {
+			uri += i.trailingPath
+		}
+
+		if i.extension != "" {
+			uri += "@" + i.extension
+		}
 	}
 
-	keys := make([]string, len(i.Options))
-	j := 0
+	options := "/"
+	for _, key := range i.pathKeys() {
+		name := key
+		if long := longOptionName(key); i.cfg.LongKeyOptions[long] {
+			name = long
+		}
+
+		options += name + ":" + i.Options[key] + "/"
+	}
+
+	return options + uri
+}
+
+// pathKeys returns the keys of the options signed in the path, in the order they are emitted.
+// imgproxy applies the options in that order, so later ones override earlier ones.
+func (i *ImgproxyURLData) pathKeys() []string {
+	keys := make([]string, 0, len(i.Options))
+	sortKeys := make(map[string]string, len(i.Options))
 	for key := range i.Options {
-		keys[j] = key
-		j++
+		long := longOptionName(key)
+		if i.cfg.UnsignedOptions[long] {
+			continue
+		}
+
+		sortKey := key
+		if i.cfg.SortByLongName {
+			sortKey = long
+		} else if i.cfg.LongKeyOptions[long] {
+			sortKey = long
+		}
+
+		keys = append(keys, key)
+		sortKeys[key] = sortKey
 	}
-	sort.Strings(keys)
+	sort.Slice(keys, func(a, b int) bool {
+		return sortKeys[keys[a]] < sortKeys[keys[b]]
+	})
 
-	options := "/"
-	for _, key := range keys {
-		options += key + ":" + i.Options[key] + "/"
+	return keys
+}
+
+// DryRun returns the unsigned /options/source path Generate would sign, without using the key.
+// An empty uri uses the source set on the builder. After Then, the source is the URL
+// generated by the previous pass, like Generate does; it's left as is if that pass fails.
+func (i *ImgproxyURLData) DryRun(uri string) string {
+	if uri == "" {
+		uri = i.source
 	}
 
-	uriWithOptions := options + uri
+	if i.parent != nil {
+		if inner, err := i.parent.Generate(uri); err == nil {
+			uri = inner
+		}
+	}
 
-	if len(i.salt) == 0 && len(i.key) == 0 {
-		return i.cfg.BaseURL + insecureSignature + uriWithOptions, nil
+	return i.OptionsPath(uri)
+}
+
+// resolveSource returns the source to generate the URL for, or the error that prevents generating it.
+func (i *ImgproxyURLData) resolveSource(uri string) (string, error) {
+	if i.err != nil {
+		return "", i.err
 	}
 
-	signature, err := getSignatureHash(i.key, i.salt, i.cfg.SignatureSize, uriWithOptions)
-	if err != nil {
-		return "", err
+	if uri == "" {
+		uri = i.source
 	}
 
-	return i.cfg.BaseURL + signature + uriWithOptions, nil
+	if i.parent != nil {
+		inner, err := i.parent.Generate(uri)
+		if err != nil {
+			return "", err
+		}
+
+		uri = inner
+	}
+
+	if uri == "" {
+		return "", errors.WithStack(ErrEmptySource)
+	}
+
+	if _, ok := i.Options["f"]; ok && i.extension != "" {
+		return "", errors.WithStack(ErrFormatConflict)
+	}
+
+	if i.cfg.SignTrailingPath && i.trailingPath != "" && (i.cfg.EncodePath || i.encodeSource) {
+		return "", errors.WithStack(ErrSignedTrailingPathEncoded)
+	}
+
+	if _, ok := i.Options["cb"]; ok && i.queryBuster != "" &&
+		i.cfg.UnsignedOptions["cachebuster"] && !i.cfg.LongKeyOptions["cachebuster"] {
+		return "", errors.WithStack(ErrQueryConflict)
+	}
+
+	if i.cfg.StrictOptions {
+		if unknown := i.unknownOptions(); len(unknown) > 0 {
+			return "", errors.Wrap(ErrUnknownOption, strings.Join(unknown, ", "))
+		}
+	}
+
+	return uri, nil
 }
 
-func getSignatureHash(key []byte, salt []byte, signatureSize int, payload string) (string, error) {
-	signature := hmac.New(sha256.New, key)
+// unknownOptions returns the sorted names of the options set that are not known to imgproxy.
+// Deprecated options are still known, WarnDeprecated reports them.
+func (i *ImgproxyURLData) unknownOptions() []string {
+	var unknown []string
+	for key := range i.Options {
+		if _, ok := longOptionNames[key]; ok {
+			continue
+		}
 
-	if _, err := signature.Write(salt); err != nil {
-		return "", errors.WithStack(err)
+		if _, ok := deprecatedOptions[key]; !ok {
+			unknown = append(unknown, key)
+		}
 	}
+	sort.Strings(unknown)
 
-	if _, err := signature.Write([]byte(payload)); err != nil {
-		return "", errors.WithStack(err)
+	return unknown
+}
+
+// warnDeprecated calls the configured WarnDeprecated callback for the deprecated options, in sorted order.
+func (i *ImgproxyURLData) warnDeprecated() {
+	if i.cfg.WarnDeprecated == nil {
+		return
+	}
+
+	var deprecated []string
+	for key := range i.Options {
+		if _, ok := deprecatedOptions[key]; ok {
+			deprecated = append(deprecated, key)
+		}
+	}
+	sort.Strings(deprecated)
+
+	for _, key := range deprecated {
+		i.cfg.WarnDeprecated(key)
 	}
+}
+
+// query returns the query string appended to the generated URL, outside of the signed path.
+func (i *ImgproxyURLData) query() string {
+	query := url.Values{}
+
+	for key, value := range i.Options {
+		if long := longOptionName(key); i.cfg.UnsignedOptions[long] {
+			if i.cfg.LongKeyOptions[long] {
+				key = long
+			}
+
+			query.Set(key, value)
+		}
+	}
+
+	if i.queryBuster != "" {
+		query.Set("cb", i.queryBuster)
+	}
+
+	if len(query) == 0 {
+		return ""
+	}
+
+	return "?" + query.Encode()
+}
+
+// baseURL returns the configured base URL with the scheme overridden by Scheme.
+func (i *ImgproxyURLData) baseURL() string {
+	if i.scheme == "" {
+		return i.cfg.BaseURL
+	}
+
+	if idx := strings.Index(i.cfg.BaseURL, "://"); idx >= 0 {
+		return i.scheme + i.cfg.BaseURL[idx:]
+	}
+
+	return i.scheme + "://" + strings.TrimPrefix(i.cfg.BaseURL, "//")
+}
+
+// Scheme overrides the scheme of the base URL in the generated URL. The signature is not affected.
+// The scheme must be http or https and the base URL must have a host, otherwise Generate returns an error.
+func (i *ImgproxyURLData) Scheme(scheme string) *ImgproxyURLData {
+	if scheme != "http" && scheme != "https" {
+		return i.setError(errors.Wrapf(ErrInvalidScheme, "%q", scheme))
+	}
+
+	if base, err := url.Parse(i.cfg.BaseURL); err != nil || base.Host == "" {
+		return i.setError(errors.Wrapf(ErrInvalidBaseURL, "%q has no host to set the scheme of", i.cfg.BaseURL))
+	}
+
+	i.scheme = scheme
+	return i
+}
+
+// GenerateWithHashsum generates the imgproxy URL with the hashsum option set,
+// so imgproxy only processes the source when it matches the expected hash.
+func (i *ImgproxyURLData) GenerateWithHashsum(uri string, algo string, hash string) (string, error) {
+	return i.Clone().Hashsum(algo, hash).Generate(uri)
+}
 
-	sha := base64.RawURLEncoding.EncodeToString(signature.Sum(nil)[:signatureSize])
+// Hashsum makes imgproxy check the source image against the given hash before processing it,
+// computed with the given algorithm, e.g. sha256.
+func (i *ImgproxyURLData) Hashsum(algorithm string, hash string) *ImgproxyURLData {
+	return i.SetOption("hs", algorithm+":"+hash)
+}
 
-	return sha, nil
+// GenerateFromURL generates the imgproxy URL for a source given as a *url.URL.
+func (i *ImgproxyURLData) GenerateFromURL(src *url.URL) (string, error) {
+	return i.Generate(src.String())
 }
 
 // ResizingType enum.
@@ -93,14 +350,38 @@ const (
 )
 
 // Resize resizes the image.
+// When OmitResizeDefaults is configured, trailing false enlarge and extend arguments are left out.
 func (i *ImgproxyURLData) Resize(resizingType ResizingType, width int, height int, enlarge bool, extend bool) *ImgproxyURLData {
-	return i.SetOption("rs", fmt.Sprintf(
-		"%s:%d:%d:%s:%s",
-		resizingType,
-		width, height,
-		boolAsNumberString(enlarge),
-		boolAsNumberString(extend),
-	))
+	value := fmt.Sprintf("%s:%d:%d", resizingType, width, height)
+
+	switch {
+	case extend || !i.cfg.OmitResizeDefaults:
+		value += ":" + boolAsNumberString(enlarge) + ":" + boolAsNumberString(extend)
+	case enlarge:
+		value += ":1"
+	}
+
+	return i.SetOption("rs", value)
+}
+
+// Fit resizes the image to fit the given size, enlarging it when it is smaller.
+func (i *ImgproxyURLData) Fit(width int, height int) *ImgproxyURLData {
+	return i.Resize(ResizingTypeFit, width, height, true, false)
+}
+
+// FitNoEnlarge resizes the image to fit the given size without enlarging it.
+func (i *ImgproxyURLData) FitNoEnlarge(width int, height int) *ImgproxyURLData {
+	return i.Resize(ResizingTypeFit, width, height, false, false)
+}
+
+// Fill resizes the image to fill the given size, enlarging it when it is smaller.
+func (i *ImgproxyURLData) Fill(width int, height int) *ImgproxyURLData {
+	return i.Resize(ResizingTypeFill, width, height, true, false)
+}
+
+// FillNoEnlarge resizes the image to fill the given size without enlarging it.
+func (i *ImgproxyURLData) FillNoEnlarge(width int, height int) *ImgproxyURLData {
+	return i.Resize(ResizingTypeFill, width, height, false, false)
 }
 
 // Size sets size option.
@@ -117,6 +398,29 @@ func (i *ImgproxyURLData) ResizingType(resizingType ResizingType) *ImgproxyURLDa
 	return i.SetOption("rs", string(resizingType))
 }
 
+// ResizingAlgorithm enum.
+type ResizingAlgorithm string
+
+// ResizingAlgorithm enum.
+const (
+	ResizingAlgorithmNearest  = ResizingAlgorithm("nearest")
+	ResizingAlgorithmLinear   = ResizingAlgorithm("linear")
+	ResizingAlgorithmCubic    = ResizingAlgorithm("cubic")
+	ResizingAlgorithmLanczos2 = ResizingAlgorithm("lanczos2")
+	ResizingAlgorithmLanczos3 = ResizingAlgorithm("lanczos3")
+)
+
+// ResizingAlgorithm sets the algorithm imgproxy uses for resizing.
+func (i *ImgproxyURLData) ResizingAlgorithm(algorithm ResizingAlgorithm) *ImgproxyURLData {
+	return i.SetOption("ra", string(algorithm))
+}
+
+// HighQualityDownscale resizes with the lanczos3 algorithm, imgproxy's sharpest and slowest one.
+// It gives the best results when downscaling, at the cost of more processing time.
+func (i *ImgproxyURLData) HighQualityDownscale() *ImgproxyURLData {
+	return i.ResizingAlgorithm(ResizingAlgorithmLanczos3)
+}
+
 // Width defines the width of the resulting image.
 // When set to 0, imgproxy will calculate width using the defined height and source aspect ratio.
 // When set to 0 and resizing type is force, imgproxy will keep the original width.
@@ -140,6 +444,50 @@ func (i *ImgproxyURLData) DPR(dpr int) *ImgproxyURLData {
 	return i
 }
 
+// MinWidth defines the minimum width of the resulting image.
+func (i *ImgproxyURLData) MinWidth(width int) *ImgproxyURLData {
+	return i.SetOption("mw", strconv.Itoa(width))
+}
+
+// MinHeight defines the minimum height of the resulting image.
+func (i *ImgproxyURLData) MinHeight(height int) *ImgproxyURLData {
+	return i.SetOption("mh", strconv.Itoa(height))
+}
+
+// AspectLock fills the given width and the height matching the aspect ratio, e.g. 16.0/9.0, rounded to the nearest pixel.
+// A ratio of 0 or less makes Generate return an error.
+func (i *ImgproxyURLData) AspectLock(width int, ratio float64) *ImgproxyURLData {
+	if ratio <= 0 {
+		return i.setError(errors.Wrapf(ErrInvalidAspectRatio, "%s", formatFloat(ratio)))
+	}
+
+	return i.
+		ResizingType(ResizingTypeFill).
+		Width(width).
+		Height(int(math.Round(float64(width) / ratio)))
+}
+
+// Target sets the width and height in CSS pixels together with the device pixel ratio,
+// so imgproxy produces an image matching the physical pixels of the device.
+func (i *ImgproxyURLData) Target(cssWidth int, cssHeight int, dpr float64) *ImgproxyURLData {
+	i.Width(cssWidth).Height(cssHeight)
+
+	if dpr > 0 {
+		return i.SetOption("dpr", formatFloat(dpr))
+	}
+
+	return i
+}
+
+// Zoom multiplies the width and height of the image by the given factors, after it was resized.
+func (i *ImgproxyURLData) Zoom(x float64, y float64) *ImgproxyURLData {
+	if x == y {
+		return i.SetOption("z", formatFloat(x))
+	}
+
+	return i.SetOption("z", formatFloat(x)+":"+formatFloat(y))
+}
+
 // Enlarge enlarges the image.
 func (i *ImgproxyURLData) Enlarge(enlarge int) *ImgproxyURLData {
 	return i.SetOption("el", strconv.Itoa(enlarge))
@@ -170,6 +518,8 @@ func (o OffsetGravity) GetStringOption() string {
 }
 
 // FocusPoint holds the coordinates of the focus point.
+//
+// Deprecated: imgproxy expects the coordinates as fractions of the image size between 0 and 1, use FocusPointFraction.
 type FocusPoint struct {
 	X int64
 	Y int64
@@ -185,6 +535,22 @@ func (f FocusPoint) GetStringOption() string {
 	return fmt.Sprintf("fp:%d:%d", f.X, f.Y)
 }
 
+// FocusPointFraction holds the coordinates of the focus point, as fractions of the image width and height between 0 and 1.
+type FocusPointFraction struct {
+	X float64
+	Y float64
+}
+
+// SetGravityOption sets gravity option.
+func (f FocusPointFraction) SetGravityOption(i *ImgproxyURLData) *ImgproxyURLData {
+	return i.SetOption("g", f.GetStringOption())
+}
+
+// GetStringOption gets the focus point value as string.
+func (f FocusPointFraction) GetStringOption() string {
+	return "fp:" + formatFloat(f.X) + ":" + formatFloat(f.Y)
+}
+
 // GravityEnum holds a gravity option value.
 type GravityEnum string
 
@@ -227,11 +593,123 @@ func (i *ImgproxyURLData) Gravity(g GravitySetter) *ImgproxyURLData {
 	return g.SetGravityOption(i)
 }
 
+// Trim removes the surrounding background of the image.
+// Threshold is the color similarity tolerance, color is the hex-coded background color to trim
+// (detected by imgproxy when empty), and equalHor/equalVer cut equally from both sides.
+func (i *ImgproxyURLData) Trim(threshold float64, color string, equalHor bool, equalVer bool) *ImgproxyURLData {
+	args := []string{formatFloat(threshold), color}
+	if equalHor || equalVer {
+		args = append(args, boolAsNumberString(equalHor), boolAsNumberString(equalVer))
+	}
+
+	return i.SetOption("t", joinArgs(args...))
+}
+
+// Padding adds padding to the resulting image, in pixels.
+func (i *ImgproxyURLData) Padding(top int, right int, bottom int, left int) *ImgproxyURLData {
+	return i.SetOption("pd", fmt.Sprintf("%d:%d:%d:%d", top, right, bottom, left))
+}
+
+// PaddingAll adds the same padding on all sides of the resulting image, in pixels.
+func (i *ImgproxyURLData) PaddingAll(padding int) *ImgproxyURLData {
+	return i.SetOption("pd", strconv.Itoa(padding))
+}
+
+// Extend extends the image to the requested size when it is smaller, placing it according to the gravity when set.
+func (i *ImgproxyURLData) Extend(enable bool, gravity GravitySetter) *ImgproxyURLData {
+	extend := boolAsNumberString(enable)
+
+	if gravity != nil {
+		extend += ":" + gravity.GetStringOption()
+	}
+
+	return i.SetOption("ex", extend)
+}
+
+// ExtendAspectRatio extends the image to the requested aspect ratio, placing it according to the gravity when set.
+func (i *ImgproxyURLData) ExtendAspectRatio(enable bool, gravity GravitySetter) *ImgproxyURLData {
+	extend := boolAsNumberString(enable)
+
+	if gravity != nil {
+		extend += ":" + gravity.GetStringOption()
+	}
+
+	return i.SetOption("exar", extend)
+}
+
+// Rotate rotates the image by the given angle, one of 0, 90, 180 or 270 degrees.
+// Any other angle is not set and makes Generate return an error.
+func (i *ImgproxyURLData) Rotate(angle int) *ImgproxyURLData {
+	switch angle {
+	case 0, 90, 180, 270:
+		return i.SetOption("rot", strconv.Itoa(angle))
+	}
+
+	return i.setError(errors.Wrapf(ErrInvalidRotation, "%d", angle))
+}
+
+// AutoRotate toggles the automatic rotation of the image based on its EXIF orientation.
+func (i *ImgproxyURLData) AutoRotate(enable bool) *ImgproxyURLData {
+	return i.SetOption("ar", boolAsNumberString(enable))
+}
+
 // Quality redefines quality of the resulting image, as a percentage.
 func (i *ImgproxyURLData) Quality(quality int) *ImgproxyURLData {
 	return i.SetOption("q", strconv.Itoa(quality))
 }
 
+// FormatQuality redefines the quality of the resulting image per format, as a percentage.
+// The formats are sorted, so the option value doesn't depend on the map iteration order.
+func (i *ImgproxyURLData) FormatQuality(pairs map[string]int) *ImgproxyURLData {
+	formats := make([]string, 0, len(pairs))
+	for format := range pairs {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	args := make([]string, 0, len(pairs)*2)
+	for _, format := range formats {
+		args = append(args, format, strconv.Itoa(pairs[format]))
+	}
+
+	return i.SetOption("fq", strings.Join(args, ":"))
+}
+
+// AutoqualityMethod enum.
+type AutoqualityMethod string
+
+// AutoqualityMethod enum.
+const (
+	// Disables the automatic quality calculation.
+	AutoqualityNone = AutoqualityMethod("none")
+
+	// Picks the quality matching the target file size, in bytes.
+	AutoqualitySize = AutoqualityMethod("size")
+
+	// Picks the quality matching the target DSSIM score.
+	AutoqualityDSSIM = AutoqualityMethod("dssim")
+
+	// Predicts the quality matching the target DSSIM score with a neural network.
+	AutoqualityML = AutoqualityMethod("ml")
+)
+
+// Autoquality makes imgproxy calculate the quality of the resulting image with the given method.
+// Zero arguments are left to imgproxy's defaults, trailing ones are left out.
+func (i *ImgproxyURLData) Autoquality(method AutoqualityMethod, target float64, minQuality int, maxQuality int) *ImgproxyURLData {
+	return i.SetOption("aq", joinArgs(
+		string(method),
+		optionalFloat(target),
+		optionalInt(minQuality),
+		optionalInt(maxQuality),
+	))
+}
+
+// MaxBytes limits the file size of the resulting image, in bytes.
+// imgproxy lowers the quality until the image fits. It only applies to lossy formats.
+func (i *ImgproxyURLData) MaxBytes(bytes int) *ImgproxyURLData {
+	return i.SetOption("mb", strconv.Itoa(bytes))
+}
+
 // HexColor holds an hexadecimal format color.
 type HexColor string
 
@@ -265,6 +743,40 @@ func (i *ImgproxyURLData) Background(bg BackgroundSetter) *ImgproxyURLData {
 	return bg.SetBgOption(i)
 }
 
+// LetterboxTo fits the image in the given size without enlarging it,
+// extending it to the exact size with the background color around it.
+// The extension is set by the resize option itself, so a separate extend option can't turn it off.
+func (i *ImgproxyURLData) LetterboxTo(width int, height int, bg BackgroundSetter) *ImgproxyURLData {
+	return i.Resize(ResizingTypeFit, width, height, false, true).
+		Background(bg)
+}
+
+// LetterboxToFormat letterboxes the image like LetterboxTo and converts it to the given format,
+// e.g. JPEG to fill the transparent areas of a PNG with the background color.
+func (i *ImgproxyURLData) LetterboxToFormat(width int, height int, bg BackgroundSetter, format ImageFormat) *ImgproxyURLData {
+	return i.LetterboxTo(width, height, bg).Format(string(format))
+}
+
+// Brightness adjusts the brightness of the resulting image, between -255 and 255.
+func (i *ImgproxyURLData) Brightness(brightness int) *ImgproxyURLData {
+	return i.SetOption("br", strconv.Itoa(brightness))
+}
+
+// Contrast adjusts the contrast of the resulting image, 1 keeps it unchanged.
+func (i *ImgproxyURLData) Contrast(contrast float64) *ImgproxyURLData {
+	return i.SetOption("co", formatFloat(contrast))
+}
+
+// Saturation adjusts the saturation of the resulting image, 1 keeps it unchanged.
+func (i *ImgproxyURLData) Saturation(saturation float64) *ImgproxyURLData {
+	return i.SetOption("sa", formatFloat(saturation))
+}
+
+// Adjust sets the brightness, contrast and saturation of the resulting image at once.
+func (i *ImgproxyURLData) Adjust(brightness int, contrast float64, saturation float64) *ImgproxyURLData {
+	return i.SetOption("a", fmt.Sprintf("%d:%s:%s", brightness, formatFloat(contrast), formatFloat(saturation)))
+}
+
 // Blur applies a gaussian blur filter to the resulting image.
 // The value of sigma defines the size of the mask imgproxy will use.
 func (i *ImgproxyURLData) Blur(sigma int) *ImgproxyURLData {
@@ -277,6 +789,65 @@ func (i *ImgproxyURLData) Sharpen(sigma int) *ImgproxyURLData {
 	return i.SetOption("sh", strconv.Itoa(sigma))
 }
 
+// UnsharpMaskingMode enum.
+type UnsharpMaskingMode string
+
+// UnsharpMaskingMode enum.
+const (
+	// Applies unsharp masking only when the image is downscaled and the sharpen option is not set.
+	UnsharpMaskingModeAuto = UnsharpMaskingMode("auto")
+
+	// Never applies unsharp masking.
+	UnsharpMaskingModeNone = UnsharpMaskingMode("none")
+
+	// Always applies unsharp masking.
+	UnsharpMaskingModeAlways = UnsharpMaskingMode("always")
+)
+
+// UnsharpMasking controls the unsharp masking applied to the resulting image.
+// A zero weight or divider is left for imgproxy to default.
+func (i *ImgproxyURLData) UnsharpMasking(mode UnsharpMaskingMode, weight float64, divider float64) *ImgproxyURLData {
+	return i.SetOption("ush", joinArgs(string(mode), optionalFloat(weight), optionalFloat(divider)))
+}
+
+// BlurDetections blurs the objects of the given classes detected by imgproxy, or all detected objects when no class is given.
+func (i *ImgproxyURLData) BlurDetections(sigma int, classes ...string) *ImgproxyURLData {
+	return i.SetOption("bd", strings.Join(append([]string{strconv.Itoa(sigma)}, classes...), ":"))
+}
+
+// DrawDetections draws the bounding boxes of the objects of the given classes detected by imgproxy,
+// or of all detected objects when no class is given.
+func (i *ImgproxyURLData) DrawDetections(enable bool, classes ...string) *ImgproxyURLData {
+	return i.SetOption("dd", strings.Join(append([]string{boolAsNumberString(enable)}, classes...), ":"))
+}
+
+// Pixelate pixelates the resulting image using blocks of the given size, in pixels.
+func (i *ImgproxyURLData) Pixelate(size int) *ImgproxyURLData {
+	if size > 0 {
+		return i.SetOption("pix", strconv.Itoa(size))
+	}
+
+	return i
+}
+
+// GradientDirection holds the direction of a gradient.
+// Directions other than the named ones, like an angle in degrees, can be given as GradientDirection("45").
+type GradientDirection string
+
+// GradientDirection enum.
+const (
+	GradientDown  = GradientDirection("down")
+	GradientUp    = GradientDirection("up")
+	GradientLeft  = GradientDirection("left")
+	GradientRight = GradientDirection("right")
+)
+
+// Gradient places a gradient on the processed image.
+// Empty color and direction and zero start and stop are left for imgproxy to default.
+func (i *ImgproxyURLData) Gradient(opacity float64, color string, direction GradientDirection, start float64, stop float64) *ImgproxyURLData {
+	return i.SetOption("gr", joinArgs(formatFloat(opacity), color, string(direction), optionalFloat(start), optionalFloat(stop)))
+}
+
 // WatermarkPosition holds a watermark position option.
 type WatermarkPosition string
 
@@ -321,7 +892,8 @@ type WatermarkOffset struct {
 }
 
 // Watermark places a watermark on the processed image.
-func (i *ImgproxyURLData) Watermark(opacity int, position WatermarkPosition, offset *WatermarkOffset, scale int) *ImgproxyURLData {
+// The scale defines the watermark size relative to the resulting image size, 0 keeping its original size.
+func (i *ImgproxyURLData) Watermark(opacity int, position WatermarkPosition, offset *WatermarkOffset, scale float64) *ImgproxyURLData {
 	var offsetStr string
 
 	if offset != nil {
@@ -330,11 +902,191 @@ func (i *ImgproxyURLData) Watermark(opacity int, position WatermarkPosition, off
 
 	return i.SetOption("wm",
 		fmt.Sprintf(
-			"%d:%s%s:%d", opacity, position, offsetStr, scale,
+			"%d:%s%s:%s", opacity, position, offsetStr, formatFloat(scale),
 		),
 	)
 }
 
+// WatermarkScaleFraction scales the watermark to the given fraction of the resulting image size,
+// clamped between 0 and 1. It updates the scale of the watermark set by Watermark,
+// or places a fully opaque, centered watermark without offset when none is set. Missing arguments of a watermark
+// set by SetOption are filled with these defaults, so only the scale is replaced.
+func (i *ImgproxyURLData) WatermarkScaleFraction(fraction float64) *ImgproxyURLData {
+	fraction = math.Max(0, math.Min(1, fraction))
+
+	args := []string{"1", string(WatermarkPositionCenter), "0", "0", formatFloat(fraction)}
+
+	if value, ok := i.Options["wm"]; ok {
+		set := strings.Split(value, ":")
+
+		// Watermark without offset sets opacity:position:scale.
+		if len(set) == 3 {
+			set = set[:2]
+		}
+
+		copy(args[:4], set)
+	}
+
+	return i.SetOption("wm", strings.Join(args, ":"))
+}
+
+// WatermarkURL uses the image at the given URL as the watermark.
+func (i *ImgproxyURLData) WatermarkURL(watermarkURL string) *ImgproxyURLData {
+	return i.SetOption("wmu", base64.RawURLEncoding.EncodeToString([]byte(watermarkURL)))
+}
+
+// WatermarkText uses the given text as the watermark. The text can contain Pango markup.
+func (i *ImgproxyURLData) WatermarkText(text string) *ImgproxyURLData {
+	return i.SetOption("wmt", base64.RawURLEncoding.EncodeToString([]byte(text)))
+}
+
+// WatermarkSize sets the size of the watermark, in pixels.
+// When width or height is 0, it is calculated to keep the aspect ratio of the watermark.
+func (i *ImgproxyURLData) WatermarkSize(width int, height int) *ImgproxyURLData {
+	return i.SetOption("wms", fmt.Sprintf("%d:%d", width, height))
+}
+
+// WatermarkRotate rotates the watermark by the given angle, in degrees.
+func (i *ImgproxyURLData) WatermarkRotate(angle float64) *ImgproxyURLData {
+	return i.SetOption("wmr", formatFloat(angle))
+}
+
+// WatermarkShadow adds a shadow to the watermark, sigma defining the size of its blur.
+func (i *ImgproxyURLData) WatermarkShadow(sigma float64) *ImgproxyURLData {
+	return i.SetOption("wmsh", formatFloat(sigma))
+}
+
+// WatermarkConfig holds the parameters of the watermark option.
+type WatermarkConfig struct {
+	Opacity  int
+	Position WatermarkPosition
+	Offset   *WatermarkOffset
+	Scale    float64
+}
+
+// WithWatermarkApplied returns a clone of the builder with the watermark applied, leaving the builder untouched.
+func (i *ImgproxyURLData) WithWatermarkApplied(cfg WatermarkConfig) *ImgproxyURLData {
+	return i.Clone().Watermark(cfg.Opacity, cfg.Position, cfg.Offset, cfg.Scale)
+}
+
+// Style prepends the given CSS to the SVG source image, e.g. to recolor icons.
+// The CSS is base64url encoded, so its colons and semicolons don't clash with the option delimiters.
+func (i *ImgproxyURLData) Style(css string) *ImgproxyURLData {
+	return i.SetOption("st", base64.RawURLEncoding.EncodeToString([]byte(css)))
+}
+
+// StripMetadata toggles stripping the metadata (EXIF, IPTC, etc.) from the resulting image.
+func (i *ImgproxyURLData) StripMetadata(enable bool) *ImgproxyURLData {
+	return i.SetOption("sm", boolAsNumberString(enable))
+}
+
+// KeepCopyright toggles preserving the copyright info while stripping the metadata.
+func (i *ImgproxyURLData) KeepCopyright(enable bool) *ImgproxyURLData {
+	return i.SetOption("kcr", boolAsNumberString(enable))
+}
+
+// StripColorProfile toggles stripping the color profile from the resulting image,
+// converting it to sRGB first when needed.
+func (i *ImgproxyURLData) StripColorProfile(enable bool) *ImgproxyURLData {
+	return i.SetOption("scp", boolAsNumberString(enable))
+}
+
+// DPI sets the DPI metadata of the resulting image. Values lower than 1 are ignored.
+func (i *ImgproxyURLData) DPI(dpi int) *ImgproxyURLData {
+	if dpi > 0 {
+		return i.SetOption("dpi", strconv.Itoa(dpi))
+	}
+
+	return i
+}
+
+// EnforceThumbnail makes imgproxy use the thumbnail embedded in the source image when present,
+// e.g. for HEIC and AVIF images, instead of the main image.
+func (i *ImgproxyURLData) EnforceThumbnail(enable bool) *ImgproxyURLData {
+	return i.SetOption("eth", boolAsNumberString(enable))
+}
+
+// Page selects the page of a multi-page source image, like a PDF or TIFF, to process. Pages are numbered from 0.
+func (i *ImgproxyURLData) Page(n int) *ImgproxyURLData {
+	return i.SetOption("pg", strconv.Itoa(n))
+}
+
+// Pages sets the number of pages of a multi-page source image to process, starting from the one selected by Page.
+func (i *ImgproxyURLData) Pages(n int) *ImgproxyURLData {
+	return i.SetOption("pgs", strconv.Itoa(n))
+}
+
+// DisableAnimation makes imgproxy use only the first frame of an animated source image, like a GIF or WebP.
+func (i *ImgproxyURLData) DisableAnimation(disable bool) *ImgproxyURLData {
+	return i.SetOption("da", boolAsNumberString(disable))
+}
+
+// VideoThumbnailSecond sets the second of a video source to take the thumbnail from.
+func (i *ImgproxyURLData) VideoThumbnailSecond(second float64) *ImgproxyURLData {
+	return i.SetOption("vts", formatFloat(second))
+}
+
+// VideoThumbnailKeyframes makes imgproxy take the thumbnail from the closest keyframe, which is faster to decode.
+func (i *ImgproxyURLData) VideoThumbnailKeyframes(enable bool) *ImgproxyURLData {
+	return i.SetOption("vtk", boolAsNumberString(enable))
+}
+
+// VideoThumbnailTile generates a sprite of columns by rows thumbnails of a video source, taken every step seconds.
+// Each tile is tileWidth by tileHeight, extendTile extends the thumbnails to the tile size
+// and trim leaves out the empty tiles at the end.
+func (i *ImgproxyURLData) VideoThumbnailTile(step float64, columns int, rows int, tileWidth int, tileHeight int, extendTile bool, trim bool) *ImgproxyURLData {
+	return i.SetOption("vtt", fmt.Sprintf(
+		"%s:%d:%d:%d:%d:%s:%s",
+		formatFloat(step),
+		columns, rows,
+		tileWidth, tileHeight,
+		boolAsNumberString(extendTile),
+		boolAsNumberString(trim),
+	))
+}
+
+// FallbackImageURL sets the image imgproxy returns when the source image can't be fetched or processed.
+func (i *ImgproxyURLData) FallbackImageURL(fallbackURL string) *ImgproxyURLData {
+	return i.SetOption("fiu", base64.RawURLEncoding.EncodeToString([]byte(fallbackURL)))
+}
+
+// SkipProcessing makes imgproxy return source images of the given formats without processing them.
+// Calling it without formats leaves the option unset.
+func (i *ImgproxyURLData) SkipProcessing(formats ...string) *ImgproxyURLData {
+	if len(formats) == 0 {
+		return i
+	}
+
+	return i.SetOption("skp", strings.Join(formats, ":"))
+}
+
+// Raw makes imgproxy stream the source image without processing it or checking its size and format.
+// Most other options have no effect when it is enabled.
+func (i *ImgproxyURLData) Raw(enable bool) *ImgproxyURLData {
+	return i.SetOption("raw", boolAsNumberString(enable))
+}
+
+// MaxSrcResolution overrides the maximum resolution of the source image imgproxy accepts, in megapixels.
+func (i *ImgproxyURLData) MaxSrcResolution(megapixels float64) *ImgproxyURLData {
+	return i.SetOption("msr", formatFloat(megapixels))
+}
+
+// MaxSrcFileSize overrides the maximum file size of the source image imgproxy accepts, in bytes.
+func (i *ImgproxyURLData) MaxSrcFileSize(bytes int) *ImgproxyURLData {
+	return i.SetOption("msfs", strconv.Itoa(bytes))
+}
+
+// MaxAnimationFrames overrides the maximum number of frames of an animated source image imgproxy processes.
+func (i *ImgproxyURLData) MaxAnimationFrames(n int) *ImgproxyURLData {
+	return i.SetOption("maf", strconv.Itoa(n))
+}
+
+// MaxAnimationFrameResolution overrides the maximum resolution of a single frame of an animated source image
+// imgproxy accepts, in megapixels.
+func (i *ImgproxyURLData) MaxAnimationFrameResolution(megapixels float64) *ImgproxyURLData {
+	return i.SetOption("mafr", formatFloat(megapixels))
+}
+
 // Preset defines a list of presets to be used by imgproxy.
 func (i *ImgproxyURLData) Preset(presets ...string) *ImgproxyURLData {
 	return i.SetOption("pr", strings.Join(presets, ":"))
@@ -347,12 +1099,264 @@ func (i *ImgproxyURLData) CacheBuster(buster string) *ImgproxyURLData {
 	return i.SetOption("cb", buster)
 }
 
+// Expires makes imgproxy reject the URL from the given time on.
+func (i *ImgproxyURLData) Expires(t time.Time) *ImgproxyURLData {
+	return i.SetOption("exp", strconv.FormatInt(t.Unix(), 10))
+}
+
+// ExpiresIn makes imgproxy reject the URL once the given duration has passed, starting from the configured Clock.
+func (i *ImgproxyURLData) ExpiresIn(d time.Duration) *ImgproxyURLData {
+	return i.Expires(i.cfg.Clock().Add(d))
+}
+
+// IsExpired reports whether the expiration set by ExpiresIn has passed, according to the configured Clock.
+// It returns false when no valid expiration is set.
+func (i *ImgproxyURLData) IsExpired() bool {
+	value, ok := i.Options["exp"]
+	if !ok {
+		return false
+	}
+
+	expires, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	return !i.cfg.Clock().Before(time.Unix(expires, 0))
+}
+
+// TrailingPath appends a path suffix after the source, for CDNs routing on it.
+// By default the suffix is not signed, the CDN is expected to strip it before forwarding the request to imgproxy.
+// With SignTrailingPath configured the suffix is signed and passed on to imgproxy as part of the plain source,
+// before its extension. Generate returns an error when it is combined with an encoded source.
+func (i *ImgproxyURLData) TrailingPath(suffix string) *ImgproxyURLData {
+	i.trailingPath = "/" + strings.TrimPrefix(suffix, "/")
+	return i
+}
+
+// QueryCacheBust appends the token as a cb query string parameter to the generated URL,
+// for CDNs that only vary their cache on the query string.
+// The query string is not signed, prefer CacheBuster whenever possible.
+func (i *ImgproxyURLData) QueryCacheBust(token string) *ImgproxyURLData {
+	i.queryBuster = token
+	return i
+}
+
 // Format specifies the resulting image format. Alias for the extension part of the URL.
 func (i *ImgproxyURLData) Format(extension string) *ImgproxyURLData {
 	return i.SetOption("f", extension)
 }
 
+// DataURISource sets an inline data URI as the source of the image, to be generated with an empty uri.
+// The source is always base64 encoded in the URL.
+func (i *ImgproxyURLData) DataURISource(mime string, data []byte) *ImgproxyURLData {
+	i.source = "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data)
+	i.encodeSource = true
+
+	return i
+}
+
+// Extension specifies the resulting image format as the extension of the source in the URL.
+// It can't be combined with the format option.
+func (i *ImgproxyURLData) Extension(extension string) *ImgproxyURLData {
+	i.extension = extension
+	return i
+}
+
+// ProgressiveJPEG sets the resulting image format to JPEG and enables progressive rendering through the jpeg options.
+func (i *ImgproxyURLData) ProgressiveJPEG() *ImgproxyURLData {
+	return i.Format(string(ImageFormatJPEG)).JpegOptions(JPEGOptions{Progressive: true})
+}
+
+// JPEGOptions holds the advanced JPEG saving options, in the order imgproxy expects them.
+type JPEGOptions struct {
+	Progressive        bool
+	NoSubsample        bool
+	TrellisQuant       bool
+	OvershootDeringing bool
+	OptimizeScans      bool
+	QuantTable         int
+}
+
+// JpegOptions sets the advanced JPEG saving options. Trailing defaults are left out,
+// and the option is removed when all of them are defaults.
+func (i *ImgproxyURLData) JpegOptions(opts JPEGOptions) *ImgproxyURLData {
+	return i.setAdvancedOptions("jpgo", joinNonDefaultArgs(
+		boolAsNumberString(opts.Progressive),
+		boolAsNumberString(opts.NoSubsample),
+		boolAsNumberString(opts.TrellisQuant),
+		boolAsNumberString(opts.OvershootDeringing),
+		boolAsNumberString(opts.OptimizeScans),
+		strconv.Itoa(opts.QuantTable),
+	))
+}
+
+// PNGOptions holds the advanced PNG saving options, in the order imgproxy expects them.
+type PNGOptions struct {
+	Interlaced         bool
+	Quantize           bool
+	QuantizationColors int
+}
+
+// PngOptions sets the advanced PNG saving options. Trailing defaults are left out,
+// and the option is removed when all of them are defaults.
+func (i *ImgproxyURLData) PngOptions(opts PNGOptions) *ImgproxyURLData {
+	return i.setAdvancedOptions("pngo", joinNonDefaultArgs(
+		boolAsNumberString(opts.Interlaced),
+		boolAsNumberString(opts.Quantize),
+		strconv.Itoa(opts.QuantizationColors),
+	))
+}
+
+// WebPCompression enum.
+type WebPCompression string
+
+// WebPCompression enum.
+const (
+	WebPCompressionLossy        = WebPCompression("lossy")
+	WebPCompressionNearLossless = WebPCompression("near_lossless")
+	WebPCompressionLossless     = WebPCompression("lossless")
+)
+
+// WebPOptions holds the advanced WebP saving options, in the order imgproxy expects them.
+// An empty Compression is left for imgproxy to default.
+type WebPOptions struct {
+	Compression    WebPCompression
+	SmartSubsample bool
+}
+
+// WebpOptions sets the advanced WebP saving options. Trailing defaults are left out,
+// and the option is removed when all of them are defaults.
+func (i *ImgproxyURLData) WebpOptions(opts WebPOptions) *ImgproxyURLData {
+	return i.setAdvancedOptions("webpo", joinNonDefaultArgs(
+		string(opts.Compression),
+		boolAsNumberString(opts.SmartSubsample),
+	))
+}
+
+// setAdvancedOptions sets the option to the given value, or removes it when the value is empty.
+func (i *ImgproxyURLData) setAdvancedOptions(key string, value string) *ImgproxyURLData {
+	if value == "" {
+		return i.RemoveOption(key)
+	}
+
+	return i.SetOption(key, value)
+}
+
+// ImageFormat holds a resulting image format.
+type ImageFormat string
+
+// ImageFormat constants.
+const (
+	ImageFormatJPEG = ImageFormat("jpg")
+	ImageFormatPNG  = ImageFormat("png")
+	ImageFormatWebP = ImageFormat("webp")
+	ImageFormatAVIF = ImageFormat("avif")
+	ImageFormatGIF  = ImageFormat("gif")
+	ImageFormatICO  = ImageFormat("ico")
+	ImageFormatSVG  = ImageFormat("svg")
+	ImageFormatHEIC = ImageFormat("heic")
+	ImageFormatBMP  = ImageFormat("bmp")
+	ImageFormatTIFF = ImageFormat("tiff")
+	ImageFormatBest = ImageFormat("best")
+)
+
+// contentTypes maps the resulting image formats to the Content-Type imgproxy returns them with.
+var contentTypes = map[ImageFormat]string{
+	ImageFormatJPEG:     "image/jpeg",
+	ImageFormat("jpeg"): "image/jpeg",
+	ImageFormatPNG:      "image/png",
+	ImageFormatWebP:     "image/webp",
+	ImageFormatAVIF:     "image/avif",
+	ImageFormatGIF:      "image/gif",
+	ImageFormatICO:      "image/x-icon",
+	ImageFormatSVG:      "image/svg+xml",
+	ImageFormatHEIC:     "image/heif",
+	ImageFormatBMP:      "image/bmp",
+	ImageFormatTIFF:     "image/tiff",
+}
+
+// ExpectedContentType returns the Content-Type of the resulting image, based on the format option or the source extension.
+// It returns false when the format is unset, best, or unknown.
+func (i *ImgproxyURLData) ExpectedContentType() (string, bool) {
+	contentType, ok := contentTypes[i.resultFormat()]
+	return contentType, ok
+}
+
+// resultFormat returns the lowercased format of the resulting image, set by the format option or the source extension.
+func (i *ImgproxyURLData) resultFormat() ImageFormat {
+	format := i.extension
+	if value, ok := i.Options["f"]; ok {
+		format, _, _ = strings.Cut(value, ":")
+	}
+
+	return ImageFormat(strings.ToLower(format))
+}
+
+// FormatWithQuality sets the format of the resulting image together with its quality.
+// Validate reports the quality as ineffective for lossless formats such as PNG.
+func (i *ImgproxyURLData) FormatWithQuality(format ImageFormat, quality int) *ImgproxyURLData {
+	return i.Format(string(format)).Quality(quality)
+}
+
+// FormatBestWith makes imgproxy pick the best resulting format among the given ones, in order of preference.
+// An empty list makes Generate return an error.
+func (i *ImgproxyURLData) FormatBestWith(formats ...ImageFormat) *ImgproxyURLData {
+	if len(formats) == 0 {
+		return i.setError(errors.WithStack(ErrEmptyFormatList))
+	}
+
+	value := string(ImageFormatBest)
+	for _, format := range formats {
+		value += ":" + string(format)
+	}
+
+	return i.SetOption("f", value)
+}
+
+// FilenameFromSource sets the filename option to the basename of the source with its extension
+// replaced by the given format. The filename is base64 encoded when it can't be passed as is.
+// The option is left unset when the source has no basename, e.g. a bare host.
+func (i *ImgproxyURLData) FilenameFromSource(uri string, format ImageFormat) *ImgproxyURLData {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return i
+	}
+
+	name := path.Base(u.Path)
+	if name == "." || name == "/" {
+		return i
+	}
+
+	name = strings.TrimSuffix(name, path.Ext(name)) + "." + string(format)
+
+	return i.Filename(name, needsEncoding(name))
+}
+
+// ReturnAttachment makes imgproxy return the image with an attachment Content-Disposition header,
+// so browsers download it instead of displaying it.
+func (i *ImgproxyURLData) ReturnAttachment(enable bool) *ImgproxyURLData {
+	return i.SetOption("att", boolAsNumberString(enable))
+}
+
+// DownloadAs makes imgproxy return the image as an attachment with the given filename.
+// The filename is base64 encoded when it can't be passed as is.
+func (i *ImgproxyURLData) DownloadAs(filename string) *ImgproxyURLData {
+	return i.ReturnAttachment(true).Filename(filename, needsEncoding(filename))
+}
+
+// Filename sets the filename imgproxy returns the image with, in the Content-Disposition header.
+// An encoded filename is base64url encoded, which is required when it contains characters like a slash or colon.
+func (i *ImgproxyURLData) Filename(name string, encoded bool) *ImgproxyURLData {
+	if encoded {
+		return i.SetOption("fn", base64.RawURLEncoding.EncodeToString([]byte(name))+":1")
+	}
+
+	return i.SetOption("fn", name)
+}
+
 // Crop sets the crop option.
+// The gravity can be a FocusPointFraction to crop around a focus point.
 func (i *ImgproxyURLData) Crop(width int, height int, gravity GravitySetter) *ImgproxyURLData {
 	crop := fmt.Sprintf("%d:%d", width, height)
 
@@ -364,7 +1368,266 @@ func (i *ImgproxyURLData) Crop(width int, height int, gravity GravitySetter) *Im
 }
 
 // SetOption sets an option on the URL.
+// Known options are matched case-insensitively by their long or short name and stored under their short name.
+// When the value exceeds the configured MaxOptionValueLen, the option is not set and Generate returns an error.
 func (i *ImgproxyURLData) SetOption(key, value string) *ImgproxyURLData {
-	i.Options[key] = value
+	if i.cfg.MaxOptionValueLen > 0 && len(value) > i.cfg.MaxOptionValueLen {
+		return i.setError(errors.Wrapf(ErrOptionValueTooLong, "option %q", key))
+	}
+
+	i.Options[canonicalOptionName(key)] = value
+	return i
+}
+
+// RemoveOption removes the given options from the URL.
+func (i *ImgproxyURLData) RemoveOption(keys ...string) *ImgproxyURLData {
+	for _, key := range keys {
+		delete(i.Options, canonicalOptionName(key))
+	}
+
 	return i
 }
+
+// Only removes all options from the URL except the given ones.
+func (i *ImgproxyURLData) Only(keys ...string) *ImgproxyURLData {
+	keep := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		keep[canonicalOptionName(key)] = true
+	}
+
+	for key := range i.Options {
+		if !keep[key] {
+			delete(i.Options, key)
+		}
+	}
+
+	return i
+}
+
+// SetOptionArgs sets an option on the URL from its arguments.
+// Arguments containing the ":" separator are URL-encoded so they are passed as a single argument.
+func (i *ImgproxyURLData) SetOptionArgs(key string, args ...string) *ImgproxyURLData {
+	escaped := make([]string, len(args))
+	for j, arg := range args {
+		escaped[j] = escapeOptionArg(arg)
+	}
+
+	return i.SetOption(key, strings.Join(escaped, ":"))
+}
+
+// setError records the first error that occurred while building the URL, to be returned by Generate.
+func (i *ImgproxyURLData) setError(err error) *ImgproxyURLData {
+	if i.err == nil {
+		i.err = err
+	}
+
+	return i
+}
+
+// encodedOptions holds the options whose value is always base64 encoded.
+var encodedOptions = map[string]bool{
+	"st":  true,
+	"wmt": true,
+	"wmu": true,
+	"fiu": true,
+}
+
+// VerifyEncoding checks that the values of base64 encoded options decode cleanly.
+func (i *ImgproxyURLData) VerifyEncoding() error {
+	for key, value := range i.Options {
+		switch {
+		case encodedOptions[key]:
+		case key == "fn" && strings.HasSuffix(value, ":1"):
+			value = strings.TrimSuffix(value, ":1")
+		default:
+			continue
+		}
+
+		if _, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(value, "=")); err != nil {
+			return errors.Wrapf(ErrInvalidEncoding, "option %q: %s", key, err)
+		}
+	}
+
+	return nil
+}
+
+// ResultAspectRatio returns the aspect ratio of the resulting image, reduced to its smallest terms,
+// when it is determined by the options: both width and height are set and the resizing type
+// is fill, fill-down or force. The other resizing types keep the aspect ratio of the source.
+func (i *ImgproxyURLData) ResultAspectRatio() (w, h int, ok bool) {
+	width, height := i.dimensions()
+
+	switch i.resizingType() {
+	case ResizingTypeFill, ResizingTypeFillDown, ResizingTypeForce:
+	default:
+		return 0, 0, false
+	}
+
+	if width <= 0 || height <= 0 {
+		return 0, 0, false
+	}
+
+	d := gcd(width, height)
+
+	return width / d, height / d, true
+}
+
+// dimensions returns the width and height set by the width, height, size or resize options.
+// Like imgproxy, options emitted later in the path override the dimensions set by earlier ones.
+func (i *ImgproxyURLData) dimensions() (width, height int) {
+	for _, key := range i.pathKeys() {
+		var args []string
+
+		switch key {
+		case "rs":
+			args = strings.Split(i.Options[key], ":")[1:]
+		case "s":
+			args = strings.Split(i.Options[key], ":")
+		case "w":
+			width, _ = strconv.Atoi(i.Options[key])
+			continue
+		case "h":
+			height, _ = strconv.Atoi(i.Options[key])
+			continue
+		default:
+			continue
+		}
+
+		if len(args) > 0 {
+			width, _ = strconv.Atoi(args[0])
+		}
+
+		if len(args) > 1 {
+			height, _ = strconv.Atoi(args[1])
+		}
+	}
+
+	return width, height
+}
+
+// Clone returns a copy of the builder that can be modified independently.
+func (i *ImgproxyURLData) Clone() *ImgproxyURLData {
+	clone := *i
+	clone.Options = make(map[string]string, len(i.Options))
+	for key, value := range i.Options {
+		clone.Options[key] = value
+	}
+
+	return &clone
+}
+
+// Then returns a new builder for a second processing pass, whose source is the URL generated by this builder.
+// The nested URL is always base64 encoded, so its options and extension don't interfere with the outer URL.
+func (i *ImgproxyURLData) Then() *ImgproxyURLData {
+	next := i.Imgproxy.Builder()
+	next.parent = i
+	next.encodeSource = true
+
+	return next
+}
+
+// ExportOptions returns a copy of the options keyed by their long name, to be signed by Imgproxy.GenerateFromExported.
+// Only the options are exported, not the source, extension or other builder settings.
+func (i *ImgproxyURLData) ExportOptions() map[string]string {
+	options := make(map[string]string, len(i.Options))
+	for key, value := range i.Options {
+		options[longOptionName(key)] = value
+	}
+
+	return options
+}
+
+// Retina generates a URL for the image at the given width, together with a URL for its 2x variant.
+func (i *ImgproxyURLData) Retina(uri string, width int) (normal string, retina string, err error) {
+	normal, err = i.Clone().Width(width).Generate(uri)
+	if err != nil {
+		return "", "", err
+	}
+
+	retina, err = i.Clone().Width(width).DPR(2).Generate(uri)
+	if err != nil {
+		return "", "", err
+	}
+
+	return normal, retina, nil
+}
+
+// LowHigh generates a URL for the image at a low and at a high width, e.g. for progressive loading.
+func (i *ImgproxyURLData) LowHigh(uri string, lowWidth int, highWidth int) (low string, high string, err error) {
+	low, err = i.Clone().Width(lowWidth).Generate(uri)
+	if err != nil {
+		return "", "", err
+	}
+
+	high, err = i.Clone().Width(highWidth).Generate(uri)
+	if err != nil {
+		return "", "", err
+	}
+
+	return low, high, nil
+}
+
+// tinyHintWidth and tinyHintQuality define the image generated by TinyBase64Hint.
+const (
+	tinyHintWidth   = 16
+	tinyHintQuality = 10
+)
+
+// TinyBase64Hint generates a URL for a tiny, low quality version of the image without metadata,
+// meant to be fetched and inlined as a base64 data URI placeholder while the full image loads.
+// The aspect ratio of the width and height set on the builder is kept, the dimensions they were set by
+// are replaced by a single resize option. Options that would scale, pad or crop the tiny image are dropped.
+func (i *ImgproxyURLData) TinyBase64Hint(uri string) (string, error) {
+	height := 0
+	if w, h := i.dimensions(); w > 0 && h > 0 {
+		height = int(math.Max(1, math.Round(float64(h)*tinyHintWidth/float64(w))))
+	}
+
+	resizingType := i.resizingType()
+	if resizingType == "" {
+		resizingType = ResizingTypeFit
+	}
+
+	return i.Clone().
+		RemoveOption("rs", "s", "w", "h", "mw", "mh", "dpr", "z", "pd", "c").
+		Resize(resizingType, tinyHintWidth, height, false, false).
+		Quality(tinyHintQuality).
+		StripMetadata(true).
+		Generate(uri)
+}
+
+// FocusVariants generates a URL for each focus point, using it as the gravity, e.g. to preview crop alternatives.
+func (i *ImgproxyURLData) FocusVariants(uri string, points []FocusPointFraction) ([]string, error) {
+	urls := make([]string, len(points))
+
+	for idx, point := range points {
+		generated, err := i.Clone().Gravity(point).Generate(uri)
+		if err != nil {
+			return nil, err
+		}
+
+		urls[idx] = generated
+	}
+
+	return urls, nil
+}
+
+// DiffOptions returns the options that differ between a and b, keyed by option name.
+// Each entry holds the value in a and the value in b, an empty string meaning the option is absent.
+func DiffOptions(a, b *ImgproxyURLData) map[string][2]string {
+	diff := make(map[string][2]string)
+
+	for key, value := range a.Options {
+		if other, ok := b.Options[key]; !ok || other != value {
+			diff[key] = [2]string{value, other}
+		}
+	}
+
+	for key, value := range b.Options {
+		if _, ok := a.Options[key]; !ok {
+			diff[key] = [2]string{"", value}
+		}
+	}
+
+	return diff
+}
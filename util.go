@@ -1,5 +1,10 @@
 package imgproxy
 
+import (
+	"strconv"
+	"strings"
+)
+
 func boolAsNumberString(i bool) string {
 	if i {
 		return "1"
@@ -7,3 +12,74 @@ func boolAsNumberString(i bool) string {
 
 	return "0"
 }
+
+// joinArgs joins option arguments, leaving out trailing empty ones.
+func joinArgs(args ...string) string {
+	for len(args) > 0 && args[len(args)-1] == "" {
+		args = args[:len(args)-1]
+	}
+
+	return strings.Join(args, ":")
+}
+
+// joinNonDefaultArgs joins option arguments, leaving out trailing empty and zero ones.
+func joinNonDefaultArgs(args ...string) string {
+	for len(args) > 0 && (args[len(args)-1] == "" || args[len(args)-1] == "0") {
+		args = args[:len(args)-1]
+	}
+
+	return strings.Join(args, ":")
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// optionalFloat formats f, or returns an empty argument when it's zero.
+func optionalFloat(f float64) string {
+	if f == 0 {
+		return ""
+	}
+
+	return formatFloat(f)
+}
+
+// optionalInt formats i, or returns an empty argument when it's zero.
+func optionalInt(i int) string {
+	if i == 0 {
+		return ""
+	}
+
+	return strconv.Itoa(i)
+}
+
+// needsEncoding reports whether s contains characters that can't be safely passed as a
+// plain option value.
+func needsEncoding(s string) bool {
+	if strings.ContainsAny(s, ":/?#%") {
+		return true
+	}
+
+	for _, r := range s {
+		if r > 127 {
+			return true
+		}
+	}
+
+	return false
+}
+
+var optionArgEscaper = strings.NewReplacer("%", "%25", ":", "%3A", "/", "%2F")
+
+// escapeOptionArg URL-encodes the characters of an option argument that would break the options path.
+func escapeOptionArg(arg string) string {
+	return optionArgEscaper.Replace(arg)
+}
@@ -0,0 +1,95 @@
+package imgproxy
+
+import (
+	stdErrs "errors"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrIneffectiveOption error.
+var ErrIneffectiveOption = stdErrs.New("option has no effect")
+
+// ErrUnsupportedOption error.
+var ErrUnsupportedOption = stdErrs.New("option not supported by the target version")
+
+// ErrResolutionTooHigh error.
+var ErrResolutionTooHigh = stdErrs.New("resulting resolution too high")
+
+// losslessFormats holds the resulting image formats the quality option has no effect on.
+var losslessFormats = map[ImageFormat]bool{
+	ImageFormatPNG: true,
+	ImageFormatGIF: true,
+	ImageFormatBMP: true,
+	ImageFormatICO: true,
+}
+
+// Validate checks the options for combinations imgproxy would ignore or reject.
+// It returns every issue found, the URL can still be generated.
+func (i *ImgproxyURLData) Validate() []error {
+	var issues []error
+
+	if i.resizingType() == ResizingTypeForce {
+		for _, key := range []string{"mw", "mh"} {
+			if _, ok := i.Options[key]; ok {
+				issues = append(issues, errors.Wrapf(ErrIneffectiveOption, "%s with %s resizing type", longOptionName(key), ResizingTypeForce))
+			}
+		}
+	}
+
+	if _, ok := i.Options["q"]; ok && losslessFormats[i.resultFormat()] {
+		issues = append(issues, errors.Wrapf(ErrIneffectiveOption, "quality with %s format", i.resultFormat()))
+	}
+
+	if i.cfg.TargetVersion > 0 {
+		for _, option := range allOptions {
+			if _, ok := i.Options[option.short]; !ok {
+				continue
+			}
+
+			if version, ok := optionVersions[option.long]; ok && version > i.cfg.TargetVersion {
+				issues = append(issues, errors.Wrapf(ErrUnsupportedOption, "%s requires imgproxy v%d", option.long, version))
+			}
+		}
+	}
+
+	return issues
+}
+
+// ValidateDimensions returns an error when the resulting resolution, the width and height multiplied by the dpr
+// on both axes, exceeds maxMegapixels. Dimensions left to imgproxy to calculate are not checked.
+func (i *ImgproxyURLData) ValidateDimensions(maxMegapixels float64) error {
+	width, height := i.dimensions()
+	if width <= 0 || height <= 0 {
+		return nil
+	}
+
+	dpr := 1.0
+	if value, ok := i.Options["dpr"]; ok {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil && parsed > 0 {
+			dpr = parsed
+		}
+	}
+
+	megapixels := float64(width) * dpr * float64(height) * dpr / 1000000
+	if megapixels > maxMegapixels {
+		return errors.Wrapf(ErrResolutionTooHigh, "%sMP exceeds %sMP", formatFloat(megapixels), formatFloat(maxMegapixels))
+	}
+
+	return nil
+}
+
+// resizingType returns the resizing type set by either the resizing_type or the resize option.
+func (i *ImgproxyURLData) resizingType() ResizingType {
+	if rt, ok := i.Options["rt"]; ok {
+		return ResizingType(rt)
+	}
+
+	if rs, ok := i.Options["rs"]; ok {
+		rt, _, _ := strings.Cut(rs, ":")
+		return ResizingType(rt)
+	}
+
+	return ""
+}